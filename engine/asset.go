@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const assetExpressionName = "asset"
+
+// An Asset is a file referenced via an asset tag, such as {{asset "styles.css"}},
+// to be copied to the output folder under a name containing a hash of its content.
+type Asset struct {
+	// Path of the source file, relative to the root build location
+	Path string
+	// Path of the hashed output file, relative to the output location
+	OutPath string
+	Content []byte
+}
+
+// URL provides the root-relative URL of the output file.
+func (a *Asset) URL() string {
+	return "/" + filepath.ToSlash(a.OutPath)
+}
+
+// AssetList collects the assets referenced across a build.
+// It's safe for use by the concurrently running stages of a build.
+type AssetList struct {
+	mutex sync.Mutex
+	items map[string]*Asset
+}
+
+func (l *AssetList) Add(a *Asset) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.items == nil {
+		l.items = make(map[string]*Asset)
+	}
+	l.items[a.Path] = a
+}
+
+// Items provides the assets collected so far, ordered by path.
+func (l *AssetList) Items() []*Asset {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var assets []*Asset
+	for _, a := range l.items {
+		assets = append(assets, a)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Path < assets[j].Path
+	})
+	return assets
+}
+
+// assetExpression provides the path referenced by the given variable
+// tag expression if it's an asset tag, such as: asset "styles.css"
+func assetExpression(expression string) (assetPath string, isAsset bool) {
+	expression = strings.TrimSpace(expression)
+	if !strings.HasPrefix(expression, assetExpressionName+" ") {
+		return "", false
+	}
+
+	arg := strings.TrimSpace(strings.TrimPrefix(expression, assetExpressionName))
+	if len(arg) < 2 || (arg[0] != '"' && arg[0] != '\'') || arg[len(arg)-1] != arg[0] {
+		return "", false
+	}
+	return arg[1 : len(arg)-1], true
+}
+
+// resolveAsset loads the asset at the given root-relative path,
+// adding it to the assets of this build, and provides its output URL.
+func (b *Builder) resolveAsset(assetPath string) ([]byte, error) {
+	cleanPath := path.Clean(strings.TrimPrefix(assetPath, "/"))
+	if cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		return nil, fmt.Errorf("Asset path \"%s\" is outside of the root build location", assetPath)
+	}
+
+	filePath := filepath.FromSlash(cleanPath)
+	r, err := b.Options.TemplateResolver.GetTemplateReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find asset \"%s\"", assetPath)
+	}
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(content)
+	ext := filepath.Ext(filePath)
+	a := &Asset{
+		Path:    filePath,
+		OutPath: strings.TrimSuffix(filePath, ext) + "." + hex.EncodeToString(hash[:])[:8] + ext,
+		Content: content,
+	}
+	b.Assets.Add(a)
+
+	return []byte(a.URL()), nil
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/ssddanbrown/haste/options"
+)
+
+// rawAttributeNames provides the names of the attributes of the given
+// raw start tag, in order and with the case they were written in.
+func rawAttributeNames(raw []byte) []string {
+	var names []string
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f'
+	}
+
+	// Skip the tag name
+	i := 1
+	for i < len(raw) && !isSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' {
+		i++
+	}
+
+	for i < len(raw) {
+		for i < len(raw) && (isSpace(raw[i]) || raw[i] == '/') {
+			i++
+		}
+		if i >= len(raw) || raw[i] == '>' {
+			break
+		}
+
+		nameStart := i
+		i++
+		for i < len(raw) && !isSpace(raw[i]) && raw[i] != '=' && raw[i] != '/' && raw[i] != '>' {
+			i++
+		}
+		names = append(names, string(raw[nameStart:i]))
+
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) || raw[i] != '=' {
+			continue
+		}
+
+		// Skip the attribute value
+		i++
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		if i < len(raw) && (raw[i] == '"' || raw[i] == '\'') {
+			quote := raw[i]
+			i++
+			for i < len(raw) && raw[i] != quote {
+				i++
+			}
+			i++
+		} else {
+			for i < len(raw) && !isSpace(raw[i]) && raw[i] != '>' {
+				i++
+			}
+		}
+	}
+
+	return names
+}
+
+// attributeVarName provides the variable name to use for an attribute
+// depending on the attribute case mode in use.
+func attributeVarName(name string, originalName string, mode string) string {
+	if !strings.EqualFold(name, originalName) {
+		return name
+	}
+
+	switch mode {
+	case options.AttributeCasePreserve:
+		return originalName
+	case options.AttributeCaseCamel:
+		return kebabToCamel(originalName)
+	}
+	return name
+}
+
+// kebabToCamel converts a kebab-case name, such as "start-at", to camelCase.
+func kebabToCamel(name string) string {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) > 0 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
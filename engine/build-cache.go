@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Name of the build cache file, stored within the root folder so it's
+// not deployed along with the output folder
+const buildCacheFileName = ".haste-cache.json"
+
+// Version of the build cache format, Caches of other versions are ignored
+const buildCacheVersion = 2
+
+// A buildCache records the sources, including all files they depend on, and
+// outputs of each BuildFile so unchanged files can be skipped on later builds.
+type buildCache struct {
+	Version     int                         `json:"version"`
+	OptionsHash string                      `json:"optionsHash"`
+	Files       map[string]*buildCacheEntry `json:"files"`
+
+	mutex sync.Mutex
+	// Hashes of source files read during this build, keyed by root relative path
+	sourceHashes map[string]string
+}
+
+type buildCacheEntry struct {
+	// Content hashes of source files keyed by root relative path
+	Sources map[string]string `json:"sources"`
+	// Content hashes of output files keyed by output relative path
+	Outputs map[string]string `json:"outputs"`
+	// Output relative paths of the pages built, excluding assets
+	Pages []string `json:"pages"`
+	// Output relative paths of the assets used keyed by root relative path
+	Assets map[string]string `json:"assets"`
+}
+
+// loadBuildCache loads the build cache from the root folder. An empty
+// cache is provided if the cache does not exist or was created using
+// different options. Returns nil if the build cache is disabled.
+func (m *Manager) loadBuildCache() *buildCache {
+	if !m.options.BuildCache {
+		return nil
+	}
+
+	optionsHash := m.optionsHash()
+	cache := &buildCache{}
+	content, err := ioutil.ReadFile(filepath.Join(m.options.RootPath, buildCacheFileName))
+	if err == nil {
+		err = json.Unmarshal(content, cache)
+	}
+
+	if err != nil || cache.Version != buildCacheVersion || cache.OptionsHash != optionsHash {
+		cache = &buildCache{
+			Version:     buildCacheVersion,
+			OptionsHash: optionsHash,
+		}
+	}
+	if cache.Files == nil {
+		cache.Files = make(map[string]*buildCacheEntry)
+	}
+	cache.sourceHashes = make(map[string]string)
+	return cache
+}
+
+// saveBuildCache writes the given cache to the root folder,
+// dropping any entries for files no longer being built.
+func (m *Manager) saveBuildCache(cache *buildCache) error {
+	for path := range cache.Files {
+		if _, ok := m.buildFiles[path]; !ok {
+			delete(cache.Files, path)
+		}
+	}
+
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(m.options.RootPath, buildCacheFileName), content, 0644)
+}
+
+// optionsHash provides a hash of the options that affect build output.
+func (m *Manager) optionsHash() string {
+	opts := *m.options
+	opts.TemplateResolver = nil
+	opts.InputPaths = nil
+	opts.Verbose = false
+	opts.Profile = ""
+	opts.Workers = 0
+	opts.Watch = false
+	opts.ServerPort = 0
+	opts.LiveReload = false
+
+	content, _ := json.Marshal(opts)
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+// isFresh checks if the given BuildFile, its dependencies and its outputs
+// are unchanged since last cached. If so, the dependencies of the BuildFile
+// and the output locations of its assets are restored from the cache.
+func (m *Manager) isFresh(cache *buildCache, bf *BuildFile) bool {
+	cache.mutex.Lock()
+	entry, ok := cache.Files[bf.path]
+	cache.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	for path, hash := range entry.Sources {
+		if cache.sourceHash(filepath.Join(m.options.RootPath, path), path) != hash {
+			return false
+		}
+	}
+	for path, hash := range entry.Outputs {
+		if fileHash(filepath.Join(m.options.OutPath, path)) != hash {
+			return false
+		}
+	}
+
+	for path := range entry.Sources {
+		if path != bf.path {
+			bf.includes[path] = true
+		}
+	}
+	bf.outputs = nil
+	for _, path := range entry.Pages {
+		bf.outputs = append(bf.outputs, filepath.Join(m.options.OutPath, path))
+	}
+
+	m.assetLock.Lock()
+	for path, outPath := range entry.Assets {
+		m.assetOutPaths[path] = filepath.Join(m.options.OutPath, outPath)
+	}
+	m.assetLock.Unlock()
+	return true
+}
+
+// updateBuildCache records the sources and given outputs of a BuildFile that
+// has just been built. Files that failed to build, or have diagnostics, are
+// not cached so that they're reported on each build.
+func (m *Manager) updateBuildCache(cache *buildCache, bf *BuildFile, outPaths []string, buildErr error) {
+	if buildErr != nil || len(bf.Diagnostics()) > 0 {
+		cache.mutex.Lock()
+		delete(cache.Files, bf.path)
+		cache.mutex.Unlock()
+		return
+	}
+
+	entry := &buildCacheEntry{
+		Sources: make(map[string]string),
+		Outputs: make(map[string]string),
+		Assets:  make(map[string]string),
+	}
+
+	sources := []string{bf.path}
+	for path := range bf.includes {
+		sources = append(sources, path)
+	}
+	for _, path := range sources {
+		entry.Sources[path] = cache.sourceHash(filepath.Join(m.options.RootPath, path), path)
+	}
+
+	for _, outPath := range outPaths {
+		relPath, err := filepath.Rel(m.options.OutPath, outPath)
+		if err == nil {
+			entry.Pages = append(entry.Pages, relPath)
+		}
+	}
+
+	for _, asset := range bf.allAssets() {
+		entry.Assets[asset.Path] = asset.OutPath
+		outPaths = append(outPaths, filepath.Join(m.options.OutPath, asset.OutPath))
+	}
+	for _, outPath := range outPaths {
+		relPath, err := filepath.Rel(m.options.OutPath, outPath)
+		if err == nil {
+			entry.Outputs[relPath] = fileHash(outPath)
+		}
+	}
+
+	cache.mutex.Lock()
+	cache.Files[bf.path] = entry
+	cache.mutex.Unlock()
+}
+
+// sourceHash provides the hash of the source file at the given path, which is
+// only read once per build since many files may depend on the same sources.
+func (c *buildCache) sourceHash(absPath string, relPath string) string {
+	c.mutex.Lock()
+	hash, ok := c.sourceHashes[relPath]
+	c.mutex.Unlock()
+	if ok {
+		return hash
+	}
+
+	hash = fileHash(absPath)
+	c.mutex.Lock()
+	c.sourceHashes[relPath] = hash
+	c.mutex.Unlock()
+	return hash
+}
+
+// fileHash provides a hash of the content of the file at the given path
+// or an empty string if the file cannot be read.
+func fileHash(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
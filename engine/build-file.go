@@ -1,8 +1,18 @@
 package engine
 
 type BuildFile struct {
-	path     string
-	includes map[string]bool
+	path        string
+	includes    map[string]bool
+	diagnostics *DiagnosticList
+	assets      *AssetList
+
+	// Paths of the files output by the last build
+	outputs []string
+
+	// Collection record options
+	outPath string
+	vars    map[string][]byte
+	records []*BuildFile
 }
 
 func NewBuildFile(path string) *BuildFile {
@@ -11,3 +21,39 @@ func NewBuildFile(path string) *BuildFile {
 		includes: make(map[string]bool),
 	}
 }
+
+// Diagnostics provides the diagnostics found in the last build of this file
+// including those of any collection records.
+func (b *BuildFile) Diagnostics() []*Diagnostic {
+	var diagnostics []*Diagnostic
+	if b.diagnostics != nil {
+		diagnostics = b.diagnostics.Items()
+	}
+	for _, record := range b.records {
+		diagnostics = append(diagnostics, record.Diagnostics()...)
+	}
+	return diagnostics
+}
+
+// allAssets provides the assets referenced in the last build
+// of this file including those of any collection records.
+func (b *BuildFile) allAssets() []*Asset {
+	var assets []*Asset
+	if b.assets != nil {
+		assets = b.assets.Items()
+	}
+	for _, record := range b.records {
+		assets = append(assets, record.allAssets()...)
+	}
+	return assets
+}
+
+// dependsOn checks if any of the includes of this file match the given function.
+func (b *BuildFile) dependsOn(matchesInclude func(include string) bool) bool {
+	for include := range b.includes {
+		if matchesInclude(include) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,9 +6,11 @@ import (
 	"github.com/ssddanbrown/haste/options"
 	"io"
 	"io/ioutil"
+	"strconv"
+	"strings"
 
 	"errors"
-	"github.com/fatih/color"
+	"fmt"
 	"golang.org/x/net/html"
 )
 
@@ -18,9 +20,32 @@ type Builder struct {
 	Vars        map[string][]byte
 	Content     []byte
 	FilesParsed map[string]bool
+	Diagnostics *DiagnosticList
+	Assets      *AssetList
 	HasParent   bool
 
-	tagStack []*templateTag
+	tagStack    []*templateTag
+	contentType string
+
+	// Location tracking, path is relative to the root build location
+	path   string
+	line   int
+	column int
+	parent *Builder
+
+	// Positions of the variable tags written to the output
+	varPositions variablePositions
+	tag    *templateTag
+	params map[string]*componentParam
+
+	// Recursion options for templates that include themselves
+	recursive         bool
+	maxRecursionDepth int
+
+	// Header directives
+	layout        []byte
+	collection    []byte
+	outputPattern []byte
 }
 
 func NewBuilder(r io.Reader, o *options.Options, parent *Builder) *Builder {
@@ -28,6 +53,9 @@ func NewBuilder(r io.Reader, o *options.Options, parent *Builder) *Builder {
 		Reader:  r,
 		Options: o,
 		HasParent: parent != nil,
+		line:    1,
+		column:  1,
+		parent:  parent,
 	}
 
 	// Create var store and copy over parent vars
@@ -35,8 +63,12 @@ func NewBuilder(r io.Reader, o *options.Options, parent *Builder) *Builder {
 	if parent != nil {
 		b.mergeVars(parent.Vars)
 		b.FilesParsed = parent.FilesParsed
+		b.Diagnostics = parent.Diagnostics
+		b.Assets = parent.Assets
 	} else {
 		b.FilesParsed = make(map[string]bool)
+		b.Diagnostics = &DiagnosticList{}
+		b.Assets = &AssetList{}
 	}
 
 	return b
@@ -48,11 +80,77 @@ func (b *Builder) mergeVars(vars map[string][]byte) {
 	}
 }
 
-func (b *Builder) Build() io.Reader {
+// removeVarsWithPrefix removes all vars with a name starting with the given prefix.
+func (b *Builder) removeVarsWithPrefix(prefix string) {
+	for k := range b.Vars {
+		if strings.HasPrefix(k, prefix) {
+			delete(b.Vars, k)
+		}
+	}
+}
+
+// Build provides a reader of the built content. For top-level builds, any
+// errors found while building are returned by the reader once all content
+// has been read, as a BuildError.
+func (b *Builder) Build() (io.Reader, error) {
 	r := b.parseTemplateVariables(b.Reader)
+	if err := b.checkRecursion(); err != nil {
+		go io.Copy(ioutil.Discard, r)
+		return bytes.NewReader(nil), err
+	}
+
+	for _, err := range b.applyParams() {
+		b.addError(0, 0, err)
+	}
+
+	// Global variables can be overridden by any variables within the file
+	if b.parent == nil {
+		for key, val := range b.Options.Vars {
+			globalVars := make(map[string][]byte)
+			flattenData(key, val, globalVars)
+			b.addHeaderVars(globalVars)
+		}
+	}
 	r = b.parseTemplateTags(r)
-	r = parseVariableTags(r, b.Vars, b.Options, !b.HasParent)
-	return r
+	r = parseVariableTags(r, b.Vars, b.Options, !b.HasParent, b.outputContext(), b.resolveAsset, b.variableErrorReporter(&b.varPositions, 0, 0))
+
+	// Markdown within a layout is rendered when the layout tag is closed
+	if b.contentType == "md" && b.layout == nil {
+		r = renderMarkdown(r, b.errorReporter(0, 0))
+	}
+
+	if b.parent == nil {
+		if b.Options.MinifyHTML {
+			r = b.minifyHTMLReader(r)
+		}
+		r = b.failOnErrors(r)
+	}
+	return r, nil
+}
+
+// failOnErrors passes through the given reader, returning a BuildError
+// at the end of the content if errors have been found in the build.
+func (b *Builder) failOnErrors(r io.Reader) io.Reader {
+	returnReader, w := io.Pipe()
+
+	go func() {
+		_, err := io.Copy(w, r)
+		if err == nil {
+			err = b.buildError()
+		}
+		w.CloseWithError(err)
+	}()
+
+	return returnReader
+}
+
+// outputContext provides the HTML context used to escape variables
+// output by this builder, or nil if auto-escaping is not enabled.
+func (b *Builder) outputContext() *htmlContext {
+	if !b.Options.AutoEscape {
+		return nil
+	}
+	return newHTMLContext(b.contentType)
 }
 
 func (b *Builder) parseTemplateTags(r io.Reader) io.Reader {
@@ -60,16 +158,39 @@ func (b *Builder) parseTemplateTags(r io.Reader) io.Reader {
 	tok := html.NewTokenizer(r)
 	go func() {
 		defer writer.Close()
+
+		// Wrap all content within the layout, if set, via a template tag
+		// so that top-level variable tags can be passed to the layout.
+		if b.layout != nil {
+			layoutTag := b.addTemplateTag(b.layout, make(map[string][]byte))
+			layoutTag.markdownContent = b.contentType == "md"
+		}
+
 		for {
 			tt := tok.Next()
 			if tt == html.ErrorToken {
+				if b.layout != nil {
+					b.closeLayoutTag(writer)
+				} else {
+					b.reportUnclosedTags(0)
+				}
+				if tok.Err() != io.EOF {
+					writer.CloseWithError(tok.Err())
+				}
 				return
 			}
 
+			nextLine, nextColumn := advancePosition(b.line, b.column, tok.Raw())
+			if !b.capturingContent() {
+				b.checkUndefinedVariables(tok.Raw())
+			}
+
 			err := b.parseToken(tok, writer)
 			if err != nil {
-				color.Red("%s", err)
+				b.addError(b.line, b.column, err)
 			}
+			b.line, b.column = nextLine, nextColumn
+			b.positionBlockContent()
 		}
 	}()
 
@@ -78,9 +199,16 @@ func (b *Builder) parseTemplateTags(r io.Reader) io.Reader {
 
 func (b *Builder) parseToken(tok *html.Tokenizer, w io.Writer) error {
 	var err error
-	raw := tok.Raw()
+
+	// Copy the raw token since reading the tag name lower-cases it, which
+	// would break case-sensitive tags such as those within SVGs
+	raw := append([]byte(nil), tok.Raw()...)
 	name, hasAttr := tok.TagName()
-	depth := len(b.tagStack)
+
+	if b.capturingContent() {
+		err = b.captureToken(name, tok, raw, w)
+		return err
+	}
 
 	isTempTag := tagNameHasPrefix(name, b.Options.TagPrefix)
 	if isTempTag {
@@ -96,12 +224,110 @@ func (b *Builder) parseToken(tok *html.Tokenizer, w io.Writer) error {
 	}
 
 	// Write injectedContent if normal tag or add to injectedContent of last in stack
+	b.recordVariablePositions(raw)
+	b.writeContent(raw, w)
+	return err
+}
+
+// capturingContent checks if the tag at the top of the stack captures its content raw.
+func (b *Builder) capturingContent() bool {
+	depth := len(b.tagStack)
+	return depth > 0 && b.tagStack[depth-1].capturesContent()
+}
+
+// writeContent adds the given content to the injectedContent of the last tag
+// in the stack or, if no tags are open, writes it to the output.
+func (b *Builder) writeContent(content []byte, w io.Writer) {
+	depth := len(b.tagStack)
 	if depth > 0 {
-		b.tagStack[depth-1].injectedContent = append(b.tagStack[depth-1].injectedContent, raw...)
+		b.tagStack[depth-1].appendContent(content)
 	} else {
-		w.Write(raw)
+		w.Write(content)
 	}
-	return err
+}
+
+// recordVariablePositions records the positions of the variable tags in the given
+// raw token content, which starts at the current position, against the last
+// tag in the stack or, if no tags are open, against this builder.
+func (b *Builder) recordVariablePositions(raw []byte) {
+	positions := &b.varPositions
+	if depth := len(b.tagStack); depth > 0 {
+		positions = &b.tagStack[depth-1].varPositions
+	}
+	positions.record(raw, b.line, b.column, b.Options)
+}
+
+// captureToken adds the raw token to the content of the block tag at the
+// top of the stack, tracking any nested block tags so the matching
+// closing tag can be found.
+func (b *Builder) captureToken(name []byte, tok *html.Tokenizer, raw []byte, w io.Writer) error {
+	tag := b.tagStack[len(b.tagStack)-1]
+	tokenType := tok.Token().Type
+
+	isTempTag := tagNameHasPrefix(name, b.Options.TagPrefix)
+	tagName := name
+	if isTempTag {
+		tagName = name[len(b.Options.TagPrefix):]
+	}
+
+	if isTempTag && isBlockTagName(tagName) {
+		if tokenType == html.StartTagToken {
+			tag.captureDepth++
+		} else if tokenType == html.EndTagToken && tag.captureDepth > 0 {
+			tag.captureDepth--
+		} else if tokenType == html.EndTagToken && bytes.Equal(tagName, tag.name) {
+			return b.closeBlockTag(w)
+		}
+	} else if isTempTag && !bytes.Equal(tagName, elseTagName) {
+		if tokenType == html.StartTagToken {
+			tag.templateDepth++
+		} else if tokenType == html.EndTagToken && tag.templateDepth > 0 {
+			tag.templateDepth--
+		}
+	}
+
+	// Else tags within nested template tags are left for those tags to handle
+	isOwnElse := tag.captureDepth == 0 && tag.templateDepth == 0
+	if isTempTag && isOwnElse && bytes.Equal(tagName, elseTagName) {
+		if tokenType != html.EndTagToken {
+			tag.inElse = true
+		}
+		return nil
+	}
+
+	tag.appendContent(raw)
+	return nil
+}
+
+// positionBlockContent sets the position that the content, or else content,
+// of the block tag at the top of the stack starts at if not yet set.
+func (b *Builder) positionBlockContent() {
+	depth := len(b.tagStack)
+	if depth == 0 || !b.tagStack[depth-1].capturesContent() {
+		return
+	}
+
+	tag := b.tagStack[depth-1]
+	if tag.line == 0 {
+		tag.line, tag.column = b.line, b.column
+	}
+	if tag.inElse && tag.elseLine == 0 {
+		tag.elseLine, tag.elseColumn = b.line, b.column
+	}
+}
+
+// advancePosition provides the line and column found after the given content
+// when starting at the given line and column.
+func advancePosition(line int, column int, content []byte) (int, int) {
+	lastNewline := bytes.LastIndexByte(content, '\n')
+	if lastNewline < 0 {
+		return line, column + len(content)
+	}
+	return line + bytes.Count(content, []byte{'\n'}), len(content) - lastNewline
+}
+
+func isBlockTagName(tagName []byte) bool {
+	return bytes.Equal(tagName, conditionalTagName) || bytes.Equal(tagName, loopTagName)
 }
 
 func tagNameHasPrefix(tagName []byte, prefix []byte) bool {
@@ -134,6 +360,9 @@ func (b *Builder) closeVariableTag() error {
 	var closingTag *templateTag
 
 	cDepth := len(b.tagStack)
+	if cDepth == 0 || b.tagStack[cDepth-1].tagType != "variable" {
+		return errors.New("Found a closing variable tag without a matching opening tag")
+	}
 	if cDepth < 2 {
 		b.tagStack = b.tagStack[:cDepth-1]
 		return errors.New("Variable tags can only be used within a template tag")
@@ -147,7 +376,21 @@ func (b *Builder) closeVariableTag() error {
 	closingTag = b.tagStack[cDepth-1]
 
 	// Add the injectedContent as an attribute variable of the parent tag
-	parentTag.attrs[string(closingTag.name)] = bytes.TrimSpace(closingTag.injectedContent)
+	// and as the next item of a list of the same name
+	varName := string(closingTag.name)
+	varContent := bytes.TrimSpace(closingTag.injectedContent)
+	parentTag.attrs[varName] = varContent
+	if parentTag.lists == nil {
+		parentTag.lists = make(map[string]bool)
+	}
+	parentTag.lists[varName] = true
+	for i := 0; ; i++ {
+		itemKey := varName + "." + strconv.Itoa(i)
+		if _, exists := parentTag.attrs[itemKey]; !exists {
+			parentTag.attrs[itemKey] = varContent
+			break
+		}
+	}
 
 	// Drop the last tag in the tracker
 	b.tagStack = b.tagStack[:cDepth-1]
@@ -158,16 +401,31 @@ func (b *Builder) parseTemplateTag(name []byte, hasAttr bool, tok *html.Tokenize
 	var err error
 	tagName := name[len(b.Options.TagPrefix):]
 
+	// Attribute names are lower-cased as they're read so the original
+	// names are found from the raw tag, except for built-in tags
+	var originalNames []string
+	isBuiltInTag := isBlockTagName(tagName) || bytes.Equal(tagName, elseTagName)
+	if hasAttr && !isBuiltInTag && b.Options.AttributeCase != options.AttributeCaseLower {
+		originalNames = rawAttributeNames(tok.Raw())
+	}
+
 	// Parse tag attrs as vars
 	tagVars := make(map[string][]byte)
+	var htmlAttrs []html.Attribute
 	if hasAttr {
-		for {
+		for i := 0; ; i++ {
 			key, val, hasMore := tok.TagAttr()
 			valCopy := make([]byte, len(val))
 			copy(valCopy, val)
-			tagValReader := parseVariableTags(bytes.NewReader(valCopy), b.Vars, b.Options, !b.HasParent)
+			tagValReader := parseVariableTags(bytes.NewReader(valCopy), b.Vars, b.Options, !b.HasParent, nil, b.resolveAsset, b.variableErrorReporter(nil, b.line, b.column))
 			valCopy, err = ioutil.ReadAll(tagValReader)
-			tagVars[string(key)] = valCopy
+
+			varName := string(key)
+			if i < len(originalNames) {
+				varName = attributeVarName(varName, originalNames[i], b.Options.AttributeCase)
+			}
+			tagVars[varName] = valCopy
+			htmlAttrs = append(htmlAttrs, html.Attribute{Key: string(key), Val: string(valCopy)})
 			if !hasMore {
 				break
 			}
@@ -176,14 +434,36 @@ func (b *Builder) parseTemplateTag(name []byte, hasAttr bool, tok *html.Tokenize
 
 	pathAttr, ok := tagVars[":name"]
 	if len(tagName) == 0 && ok {
-		tagNameReader := parseVariableTags(bytes.NewReader(pathAttr), b.Vars, b.Options, !b.HasParent)
+		tagNameReader := parseVariableTags(bytes.NewReader(pathAttr), b.Vars, b.Options, !b.HasParent, nil, b.resolveAsset, b.variableErrorReporter(nil, b.line, b.column))
 		tagName, err = ioutil.ReadAll(tagNameReader)
 	}
 
 	token := tok.Token()
 
+	if bytes.Equal(tagName, conditionalTagName) {
+		return b.parseConditionalTag(token.Type, tagVars)
+	}
+
+	if bytes.Equal(tagName, loopTagName) {
+		return b.parseLoopTag(token.Type, tagVars)
+	}
+
+	if bytes.Equal(tagName, elseTagName) {
+		return errors.New("Else tags can only be used within a conditional tag")
+	}
+
 	if token.Type == html.StartTagToken || token.Type == html.SelfClosingTagToken {
-		b.addTemplateTag(tagName, tagVars)
+		tag := b.addTemplateTag(tagName, tagVars)
+		tag.htmlAttrs = htmlAttrs
+	}
+
+	// The layout tag, if set, is only closed at the end of the content
+	openTags := len(b.tagStack)
+	if b.layout != nil {
+		openTags--
+	}
+	if token.Type == html.EndTagToken && openTags < 1 {
+		return errors.New("Found a closing template tag without a matching opening tag")
 	}
 
 	if token.Type == html.EndTagToken || token.Type == html.SelfClosingTagToken {
@@ -194,6 +474,7 @@ func (b *Builder) parseTemplateTag(name []byte, hasAttr bool, tok *html.Tokenize
 
 func (b *Builder) addTemplateTag(tagName []byte, attrs map[string][]byte) *templateTag {
 	tag := NewTemplateTag(tagName, attrs, b.Options, !b.HasParent)
+	tag.line, tag.column = b.line, b.column
 	b.tagStack = append(b.tagStack, tag)
 	return tag
 }
@@ -209,64 +490,315 @@ func (b *Builder) closeTemplateTag(writer io.Writer) (err error) {
 
 	content, err := closingTag.Parse(b)
 	if err != nil {
-		return err
+		b.tagStack = b.tagStack[:cDepth-1]
+		if _, isDiagnostic := err.(*Diagnostic); isDiagnostic {
+			return err
+		}
+		return b.diagnostic(SeverityError, closingTag.line, closingTag.column, err.Error())
 	}
 
 	if closingTag.path != "" {
 		b.FilesParsed[closingTag.path] = true
 	}
 
-	if cDepth > 1 {
-		prevTag := b.tagStack[cDepth-2]
-		prevTag.injectedContent = append(prevTag.injectedContent, content...)
-	} else {
-		writer.Write(content)
+	// Drop the last tag in the tracker
+	b.tagStack = b.tagStack[:cDepth-1]
+	b.writeContent(content, writer)
+	return err
+}
+
+// closeLayoutTag closes the layout tag at the bottom of the
+// tag stack, dropping any tags that were left unclosed.
+func (b *Builder) closeLayoutTag(writer io.Writer) {
+	b.reportUnclosedTags(1)
+	b.tagStack = b.tagStack[:1]
+
+	err := b.closeTemplateTag(writer)
+	if err != nil {
+		b.addError(b.line, b.column, err)
 	}
+}
 
-	// Drop the last tag in the tracker
+// reportUnclosedTags reports an error if tags above the given depth
+// of the tag stack were left unclosed at the end of the content.
+func (b *Builder) reportUnclosedTags(depth int) {
+	if len(b.tagStack) > depth {
+		unclosedTag := b.tagStack[depth]
+		message := fmt.Sprintf("Template tag \"%s\" was not closed before the end of the file", unclosedTag.name)
+		b.Diagnostics.Add(b.diagnostic(SeverityError, unclosedTag.line, unclosedTag.column, message))
+	}
+}
+
+func (b *Builder) parseConditionalTag(tokenType html.TokenType, attrs map[string][]byte) error {
+	if tokenType == html.EndTagToken {
+		return errors.New("Found a closing conditional tag without a matching opening tag")
+	}
+	if tokenType == html.SelfClosingTagToken {
+		return errors.New("Conditional tags cannot be self-closing")
+	}
+
+	if tokenType == html.StartTagToken {
+		tag := NewConditionalTag(attrs, b.Options)
+		b.tagStack = append(b.tagStack, tag)
+	}
+
+	if _, ok := attrs["var"]; !ok {
+		return errors.New("Conditional tags require a \"var\" attribute")
+	}
+	return nil
+}
+
+func (b *Builder) parseLoopTag(tokenType html.TokenType, attrs map[string][]byte) error {
+	if tokenType == html.EndTagToken {
+		return errors.New("Found a closing loop tag without a matching opening tag")
+	}
+	if tokenType == html.SelfClosingTagToken {
+		return errors.New("Loop tags cannot be self-closing")
+	}
+
+	if tokenType == html.StartTagToken {
+		tag := NewLoopTag(attrs, b.Options)
+		b.tagStack = append(b.tagStack, tag)
+	}
+
+	if _, ok := attrs["items"]; !ok {
+		return errors.New("Loop tags require an \"items\" attribute")
+	}
+	return nil
+}
+
+// Closes the block tag at the top of the stack by building
+// its content within the scope of this builder.
+func (b *Builder) closeBlockTag(writer io.Writer) error {
+	cDepth := len(b.tagStack)
+	closingTag := b.tagStack[cDepth-1]
 	b.tagStack = b.tagStack[:cDepth-1]
+
+	var content []byte
+	var err error
+	if closingTag.tagType == "loop" {
+		content, err = b.buildLoop(closingTag)
+	} else {
+		line, column := closingTag.chosenPosition(b.Vars)
+		content, err = b.buildFragment(closingTag.chosenContent(b.Vars), nil, line, column)
+	}
+
+	b.writeContent(content, writer)
 	return err
 }
 
+// buildLoop builds the content of a loop tag once for each item in its list
+// or builds the else content if the list has no items.
+func (b *Builder) buildLoop(tag *templateTag) ([]byte, error) {
+	items := tag.loopItemVars(b.Vars)
+	if len(items) == 0 {
+		return b.buildFragment(tag.elseContent, nil, tag.elseLine, tag.elseColumn)
+	}
+
+	var output []byte
+	for _, itemVars := range items {
+		content, err := b.buildFragment(tag.injectedContent, itemVars, tag.line, tag.column)
+		output = append(output, content...)
+		if err != nil {
+			return output, err
+		}
+	}
+	return output, nil
+}
+
+// buildFragment builds a section of template content, such as the chosen
+// branch of a conditional, using a child builder of this builder.
+// The given vars are only available within the fragment, which starts at the given position.
+func (b *Builder) buildFragment(content []byte, vars map[string][]byte, line int, column int) ([]byte, error) {
+	fragmentBuilder := NewBuilder(bytes.NewReader(content), b.Options, b)
+	fragmentBuilder.contentType = b.contentType
+	fragmentBuilder.path = b.path
+	fragmentBuilder.line = line
+	fragmentBuilder.column = column
+	fragmentBuilder.mergeVars(vars)
+	r := fragmentBuilder.parseTemplateTags(fragmentBuilder.Reader)
+	r = parseVariableTags(r, fragmentBuilder.Vars, b.Options, false, fragmentBuilder.outputContext(), b.resolveAsset, b.variableErrorReporter(&fragmentBuilder.varPositions, line, column))
+	return ioutil.ReadAll(r)
+}
+
+// Maximum length of a single line of content. Lines can be long where
+// content has been minified or images have been inlined as data URIs
+const maxLineLength = 64 * 1024 * 1024
+
+// newLineScanner provides a scanner to read the given content line by line.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	return scanner
+}
+
 func (b *Builder) parseTemplateVariables(r io.Reader) io.Reader {
 	returnReader, w := io.Pipe()
 
+	scanner := newLineScanner(r)
+	hasLine := b.parseHeader(scanner)
+
+	// Send the remaining injectedContent back via reader
+	go func() {
+		defer func() {
+			w.CloseWithError(scanner.Err())
+		}()
+		if !hasLine {
+			return
+		}
+
+		w.Write(scanner.Bytes())
+		for scanner.Scan() {
+			w.Write([]byte{'\n'})
+			w.Write(scanner.Bytes())
+		}
+	}()
+
+	return returnReader
+}
+
+// parseHeader reads in front matter and variables at the top of the scanned content.
+// Returns true if the scanner has been left on the first line of remaining content.
+func (b *Builder) parseHeader(scanner *bufio.Scanner) bool {
 	varChar := byte('@')
 	varSep := []byte{'='}
 
-	// Read in variables at the top of file
-	scanner := bufio.NewScanner(r)
-	var text []byte
-	for scanner.Scan() {
-		text = scanner.Bytes()
+	// Count scanned lines to track the line that content starts on
+	linesScanned := 0
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			linesScanned++
+		}
+		return advance, token, err
+	})
+	defer func() {
+		b.line = linesScanned
+	}()
+
+	hasLine := scanner.Scan()
+	if hasLine && isFrontMatterDelimiter(scanner.Bytes()) {
+		err := b.parseFrontMatter(scanner)
+		if err != nil {
+			b.addError(linesScanned, 1, err)
+		}
+		hasLine = scanner.Scan()
+	}
+
+	for ; hasLine; hasLine = scanner.Scan() {
+		text := scanner.Bytes()
 
 		// Read as variable if starting with variable symbol and injectedContent exists
 		// Otherwise stop reading variables
 		if len(text) > 0 && text[0] == varChar && len(text) > 1 {
-			splitVar := bytes.SplitN(text[1:], varSep, 2)
-			if len(splitVar) != 2 {
-				continue
+			var key string
+			var val []byte
+
+			if bytes.HasSuffix(text, multiLineVarOpen) && !bytes.Contains(text, varSep) {
+				// Read multi-line values until the closing line
+				startLine := linesScanned
+				key = string(bytes.TrimSpace(bytes.TrimSuffix(text[1:], multiLineVarOpen)))
+				var closed bool
+				val, closed = readMultiLineVar(scanner)
+				if !closed {
+					b.addError(startLine, 1, fmt.Errorf("Multi-line variable \"%s\" was not closed with a \"%s\" line", key, multiLineVarClose))
+				}
+			} else {
+				splitVar := bytes.SplitN(text[1:], varSep, 2)
+				if len(splitVar) != 2 {
+					continue
+				}
+				key = string(splitVar[0])
+				val = make([]byte, len(splitVar[1]))
+				copy(val, splitVar[1])
+			}
+
+			isDirective, err := b.parseHeaderDirective(key, val)
+			if err != nil {
+				b.addError(linesScanned, 1, err)
 			}
-			key := string(splitVar[0])
-			if _, exists := b.Vars[key]; !exists {
-				b.Vars[key] = splitVar[1]
+			if !isDirective {
+				b.addHeaderVars(map[string][]byte{key: val})
 			}
 		} else {
 			break
 		}
+	}
+
+	return hasLine
+}
 
+var (
+	multiLineVarOpen  = []byte("<<<")
+	multiLineVarClose = []byte(">>>")
+)
+
+// readMultiLineVar reads the lines of a multi-line header variable up to its
+// closing line. Returns false if the closing line could not be found.
+func readMultiLineVar(scanner *bufio.Scanner) ([]byte, bool) {
+	var lines [][]byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.Equal(bytes.TrimSpace(line), multiLineVarClose) {
+			return bytes.Join(lines, []byte{'\n'}), true
+		}
+
+		lineCopy := make([]byte, len(line))
+		copy(lineCopy, line)
+		lines = append(lines, lineCopy)
 	}
+	return bytes.Join(lines, []byte{'\n'}), false
+}
 
-	// Send the remaining injectedContent back via reader
-	go func() {
-		defer w.Close()
+// parseHeaderDirective handles header values that configure the builder
+// rather than being set as variables. Returns true if the key was a directive.
+func (b *Builder) parseHeaderDirective(key string, val []byte) (bool, error) {
+	var err error
+	val = bytes.TrimSpace(val)
 
-		w.Write(text)
-		for scanner.Scan() {
-			w.Write([]byte{'\n'})
-			w.Write(scanner.Bytes())
+	switch key {
+	case "layout":
+		if len(val) > 0 {
+			b.layout = val
 		}
-	}()
+	case "data":
+		err = b.loadDataFile(string(val))
+	case "collection":
+		b.collection = val
+	case "output":
+		b.outputPattern = val
+	case "recursive":
+		err = b.setRecursive(val)
+	default:
+		if !strings.HasPrefix(key, paramDirectivePrefix) {
+			return false, nil
+		}
+		err = b.addParam(strings.TrimPrefix(key, paramDirectivePrefix), val)
+	}
 
-	return returnReader
+	return true, err
+}
+
+// addHeaderVars adds variables defined at the top of a file. These do not
+// override any existing variables passed down from parent templates.
+func (b *Builder) addHeaderVars(vars map[string][]byte) {
+	for key, val := range vars {
+		if _, exists := b.Vars[key]; !exists {
+			b.Vars[key] = val
+		}
+	}
+}
+
+// addParam declares a parameter of this template from its header declaration.
+func (b *Builder) addParam(name string, spec []byte) error {
+	param, err := parseComponentParam(name, spec)
+	if err != nil {
+		return err
+	}
+
+	if b.params == nil {
+		b.params = make(map[string]*componentParam)
+	}
+	b.params[name] = param
+	return nil
 }
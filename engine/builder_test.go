@@ -1,11 +1,18 @@
 package engine
 
 import (
+	"bufio"
+	"encoding/base64"
 	"fmt"
 	"github.com/ssddanbrown/haste/loading"
+	"io"
 	"github.com/ssddanbrown/haste/options"
 	"io/ioutil"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -15,9 +22,12 @@ func simpleBuild(t *testing.T, input string, resolveMap map[string]string) strin
 	opts.TemplateResolver = resolver
 
 	builder := NewBuilder(strings.NewReader(input), opts, nil)
-	resultReader := builder.Build()
-	result, err := ioutil.ReadAll(resultReader)
+	resultReader, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Recieved error when starting build; err: %s", err)
+	}
 
+	result, err := ioutil.ReadAll(resultReader)
 	if  err != nil {
 		t.Fatalf("Recieved error when reading build result; err: %s", err)
 	}
@@ -25,6 +35,17 @@ func simpleBuild(t *testing.T, input string, resolveMap map[string]string) strin
 	return string(result)
 }
 
+// readBuild reads the full result of the given builder along with any build error.
+func readBuild(builder *Builder) (string, error) {
+	resultReader, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := ioutil.ReadAll(resultReader)
+	return string(result), err
+}
+
 func buildResultErrorMessage(expected, received string) string {
 	return fmt.Sprintf("Expected result: \n%s \n\nRecieved:\n%s", expected, received)
 }
@@ -521,4 +542,1259 @@ func TestVariableSyntaxCanBeEscapedInChildTemplates(t *testing.T) {
 	if received != expected {
 		t.Errorf(buildResultErrorMessage(expected, received))
 	}
-}
\ No newline at end of file
+}
+func TestConditionalTagUsage(t *testing.T) {
+	input := strings.TrimSpace(`
+@tree=World!
+<html><body>
+<t:if var="tree"><p>{{tree}}</p></t:if><t:if var="cat"><p>Cat</p></t:if>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<p>World!</p>
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestConditionalTagElseUsage(t *testing.T) {
+	input := strings.TrimSpace(`
+<html><body>
+<t:hello/><t:hello><v:sidebar>Sidebar</v:sidebar></t:hello>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<div>No sidebar</div><div class="sidebar">Sidebar</div>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"hello.html": "<t:if var=\"sidebar\"><div class=\"sidebar\">{{sidebar}}</div><t:else><div>No sidebar</div></t:if>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestConditionalTagEqualityAndEmptyTests(t *testing.T) {
+	input := strings.TrimSpace(`
+@size=large
+@blank=
+<html><body>
+<t:if var="size" equals="large">A</t:if><t:if var="size" equals="small">B</t:if>
+<t:if var="size" not-equals="small">C</t:if><t:if var="blank" empty>D</t:if>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+A
+CD
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestConditionalTagsOnlyBuildChosenBranch(t *testing.T) {
+	input := strings.TrimSpace(`
+<html><body>
+<t:if var="a"><t:if var="b">1<t:else>2</t:if><t:else><t:hello/><t:if var="c">3<t:else>4</t:if></t:if>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<p>Hello</p>4
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"hello.html": "<p>Hello</p>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestConditionalTagElseWithinNestedTemplateTags(t *testing.T) {
+	input := "<t:if var=\"a\"><t:card>A<t:else>B</t:card><t:else>Else</t:if>"
+
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"card.html": "<div>{{content}}</div>",
+	})
+	received, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+
+	if received != "Else" {
+		t.Errorf(buildResultErrorMessage("Else", received))
+	}
+	if err != nil {
+		t.Errorf("Expected no build errors, Got: %s", err)
+	}
+}
+
+func TestUnclosedAndSelfClosingBlockTagsAreReported(t *testing.T) {
+	cases := []struct {
+		input   string
+		message string
+	}{
+		{"<p>A</p>\n<t:if var=\"a\"><p>B</p>", "2:15: Template tag \"if\" was not closed before the end of the file"},
+		{"<p>A</p>\n<t:each items=\"a\"><p>B</p>", "2:19: Template tag \"each\" was not closed before the end of the file"},
+		{"<p>A</p>\n<t:if var=\"a\"/>", "2:1: Conditional tags cannot be self-closing"},
+		{"<p>A</p>\n<t:each items=\"a\"/>", "2:1: Loop tags cannot be self-closing"},
+	}
+
+	for _, testCase := range cases {
+		builder := NewBuilder(strings.NewReader(testCase.input), options.NewOptions(), nil)
+		_, err := readBuild(builder)
+		buildErr, isBuildError := err.(*BuildError)
+		if !isBuildError || len(buildErr.Diagnostics) != 1 || !strings.HasSuffix(buildErr.Diagnostics[0].Error(), testCase.message) {
+			t.Errorf("Expected a BuildError with message \"%s\", Got: %v", testCase.message, err)
+		}
+	}
+}
+
+func TestLoopTagOverCommaSeparatedVariable(t *testing.T) {
+	input := strings.TrimSpace(`
+@pages=Home, About,Contact
+<html><body>
+<t:each items="pages" as="page"><li>{{index}}: {{page}}</li></t:each>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<li>0: Home</li><li>1: About</li><li>2: Contact</li>
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestLoopTagOverVariableTags(t *testing.T) {
+	input := strings.TrimSpace(`
+<html><body>
+<t:menu><v:link>Home</v:link><v:link><b>About</b></v:link></t:menu>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<ul><li><b>Home</b></li><li><b><b>About</b></b></li></ul>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"menu.html": "<ul><t:each items=\"link\"><li><t:bold>{{item}}</t:bold></li></t:each></ul>",
+		"bold.html": "<b>{{content}}</b>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestVariableTagListsDoNotInheritParentItems(t *testing.T) {
+	input := `<t:menu><v:link>A</v:link><v:link>B</v:link><v:link>C</v:link></t:menu>`
+	expected := `A, B, C, | X, `
+
+	resolveMap := map[string]string {
+		"menu.html": "<t:each items=\"link\">{{item}}, </t:each>| <t:sub><v:link>X</v:link></t:sub>",
+		"sub.html": "<t:each items=\"link\">{{item}}, </t:each>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestLoopTagItemsCanBePassedToTemplateTags(t *testing.T) {
+	input := strings.TrimSpace(`
+@links=a,b
+<html><body>
+<t:each items="links" as="link" index="i"><t:link href="/{{link}}.html">{{i}}</t:link></t:each><t:each items="missing">Item<t:else>None</t:each>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<a href="/a.html">0</a><a href="/b.html">1</a>None
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"link.html": "<a href=\"{{href}}\">{{content}}</a>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestNestedLoopTags(t *testing.T) {
+	input := strings.TrimSpace(`
+@rows=1,2
+@cols=a,b
+<html><body>
+<t:each items="rows" as="row"><t:each items="cols" as="col">{{row}}{{col}} </t:each></t:each>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+1a 1b 2a 2b 
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestVariableDefaultValues(t *testing.T) {
+	input := strings.TrimSpace(`
+@title=My Page
+@empty=
+<html><body>
+<h1>{{title ?? Untitled page}}</h1><p>{{subtitle ?? No subtitle}}</p><p>{{empty??Empty}}</p>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<h1>My Page</h1><p>No subtitle</p><p>Empty</p>
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestLongVariableExpressions(t *testing.T) {
+	longDefault := strings.Repeat("A long default value ", 6)
+	input := "@name=abc\n<p>{{title ?? " + longDefault + "}}</p><p>{{name | upper | lower | upper | lower | upper | lower | upper | lower | upper | trim | escape}}</p>"
+
+	expected := "<p>" + strings.TrimSpace(longDefault) + "</p><p>ABC</p>"
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestContentDefaultValueUsedForSelfClosingTags(t *testing.T) {
+	input := strings.TrimSpace(`
+<html><body>
+<t:button/><t:button>Go</t:button>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<button>Click here</button><button>Go</button>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"button.html": "<button>{{ content ?? Click here }}</button>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestVariableFilters(t *testing.T) {
+	input := strings.TrimSpace(`
+@title=Hello World
+@slug=a b&c
+@date=2019-03-21
+@html=<b>"Hi"</b>
+<html><body>
+{{title | upper}} {{title|lower}} {{slug | urlencode}} {{date | format "02 Jan 2006"}}
+{{title | truncate 5}} {{title | truncate 5 "!" | upper}} {{html | escape}} {{missing ?? Default | lower}}
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+HELLO WORLD hello world a+b%26c 21 Mar 2019
+Hello... HELLO! &lt;b&gt;&#34;Hi&#34;&lt;/b&gt; default
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestFiltersCanBeUsedOnAttributeValues(t *testing.T) {
+	input := strings.TrimSpace(`
+<html><body>
+<t:hello name="dan"/>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<p>Hello DAN</p>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"hello.html": "<p>Hello {{name | upper}}</p>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestCustomFiltersCanBeRegistered(t *testing.T) {
+	RegisterFilter("reverse", func(val []byte, args []string) ([]byte, error) {
+		reversed := make([]byte, len(val))
+		for i, c := range val {
+			reversed[len(val)-1-i] = c
+		}
+		return reversed, nil
+	})
+
+	input := strings.TrimSpace(`
+@name=abc
+<p>{{name | reverse}}</p>
+`)
+
+	expected := "<p>cba</p>"
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestFiltersCanBeRegisteredDuringBuilds(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterFilter(fmt.Sprintf("noop%d", i), func(val []byte, args []string) ([]byte, error) {
+				return val, nil
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			builder := NewBuilder(strings.NewReader("@name=abc\n<p>{{name | upper}}</p>"), options.NewOptions(), nil)
+			received, err := readBuild(builder)
+			if err != nil || received != "<p>ABC</p>" {
+				t.Errorf(buildResultErrorMessage("<p>ABC</p>", received))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func autoEscapeBuild(t *testing.T, input string, resolveMap map[string]string) string {
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(resolveMap)
+	opts.AutoEscape = true
+
+	result, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+	if err != nil {
+		t.Fatalf("Recieved error when reading build result; err: %s", err)
+	}
+
+	return result
+}
+
+func TestAutoEscapingUsesOutputContext(t *testing.T) {
+	input := strings.TrimSpace(`
+@text=<b>"Tom" & 'Jerry'</b>
+@link=javascript:alert(1)
+@query=a&b c
+<p title="{{text}}">{{text}}</p>
+<a href="{{link}}">A</a><a href="/search?q={{query}}">B</a>
+<script>var text = "{{text}}";</script>
+<style>.a{color:{{text}};}</style>
+<p>{{text | raw}}</p>
+`)
+
+	expected := strings.TrimSpace(`
+<p title="&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;">&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;</p>
+<a href="about:invalid">A</a><a href="/search?q=a%26b+c">B</a>
+<script>var text = "\u003Cb\u003E\"Tom\" \u0026 \'Jerry\'\u003C/b\u003E";</script>
+<style>.a{color:\3c b\3e \22 Tom\22  \26  \27 Jerry\27 \3c /b\3e ;}</style>
+<p><b>"Tom" & 'Jerry'</b></p>
+`)
+
+	received := autoEscapeBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestAutoEscapingQuotesValuesOutsideScriptStrings(t *testing.T) {
+	input := strings.TrimSpace(`
+@code=1;alert(1)
+<script>var x = {{code}}; var y = 'it\'s {{code}}'; // it's
+var z = {{code}}; var w = ` + "`${a} {{code}}`" + `;</script>
+<button onclick="run({{code}})">A</button><button onclick="run('{{code}}')">B</button>
+`)
+
+	expected := strings.TrimSpace(`
+<script>var x = "1;alert(1)"; var y = 'it\'s 1;alert(1)'; // it's
+var z = "1;alert(1)"; var w = ` + "`${a} 1;alert(1)`" + `;</script>
+<button onclick="run(&#34;1;alert(1)&#34;)">A</button><button onclick="run('1;alert(1)')">B</button>
+`)
+
+	received := autoEscapeBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestAutoEscapingOfTemplateAttributes(t *testing.T) {
+	input := strings.TrimSpace(`
+<t:book author="Dan &quot;Brown&quot;"><i>{{content}}</i></t:book>
+`)
+
+	expected := strings.TrimSpace(`
+<div data-author="Dan &#34;Brown&#34;">Dan &#34;Brown&#34;: <i></i></div>
+`)
+
+	resolveMap := map[string]string {
+		"book.html": "<div data-author=\"{{author}}\">{{author}}: {{content | raw}}</div>",
+	}
+
+	received := autoEscapeBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestDataFilesCanBeLoadedAsVariables(t *testing.T) {
+	input := strings.TrimSpace(`
+@data=data/team.json
+@data=data/site.yaml
+@data=data/settings.toml
+<html><body>
+<h1>{{site.title}}</h1><p>{{team.lead.name}} ({{team.lead.age}})</p><p>{{settings.theme.color}}</p>
+<ul><t:each items="team.members" as="member"><li>{{member.name}}</li></t:each></ul>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<h1>Our Team</h1><p>Dan (30)</p><p>blue</p>
+<ul><li>Alex</li><li>Sam</li></ul>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"data/team.json": `{"lead": {"name": "Dan", "age": 30}, "members": [{"name": "Alex"}, {"name": "Sam"}]}`,
+		"data/site.yaml": "title: Our Team\n",
+		"data/settings.toml": "[theme]\ncolor = \"blue\"\n",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestDataFileVariablesPassDownToChildTemplates(t *testing.T) {
+	input := strings.TrimSpace(`
+@data=data/links.json
+<html><body>
+<t:menu/>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<a href="/">Home</a><a href="/about.html">About</a>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"data/links.json": `[{"url": "/", "text": "Home"}, {"url": "/about.html", "text": "About"}]`,
+		"menu.html": "<t:each items=\"links\" as=\"link\"><a href=\"{{link.url}}\">{{link.text}}</a></t:each>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestYAMLFrontMatterVariables(t *testing.T) {
+	input := strings.TrimSpace(`
+---
+title: My Page
+description: >
+  A long description
+  over multiple lines
+tags: [news, go]
+count: 3
+---
+@subtitle=Header lines still work
+<html><body>
+<h1>{{title}}</h1><h2>{{subtitle}}</h2><p>{{description}}</p><p>{{count}}</p>
+<t:each items="tags" as="tag">#{{tag}} </t:each>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<h1>My Page</h1><h2>Header lines still work</h2><p>A long description over multiple lines
+</p><p>3</p>
+#news #go 
+</body></html>
+`)
+
+	received := simpleBuild(t, input, nil)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestTOMLFrontMatterInChildTemplates(t *testing.T) {
+	input := strings.TrimSpace(`
+<html><body>
+<t:hello/><t:hello name="World"/>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<p>Hello Cat!</p><p>Hello World!</p>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"hello.html": "+++\nname = \"Cat\"\n+++\n<p>Hello {{name}}!</p>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestFrontMatterCanLoadDataFiles(t *testing.T) {
+	input := strings.TrimSpace(`
+---
+data: [data/team.json]
+---
+<p>{{team.lead}}</p>
+`)
+
+	expected := "<p>Dan</p>"
+
+	resolveMap := map[string]string {
+		"data/team.json": `{"lead": "Dan"}`,
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestMarkdownTagUsage(t *testing.T) {
+	input := strings.TrimSpace(`
+@title=Hello
+<html><body>
+<t:posts.hello.md name="World"/>
+</body></html>
+`)
+
+	expected := strings.TrimSpace(`
+<html><body>
+<h1>Hello World</h1>
+<table>
+<thead>
+<tr>
+<th>A</th>
+</tr>
+</thead>
+<tbody>
+<tr>
+<td><em>b</em></td>
+</tr>
+</tbody>
+</table>
+<pre><code class="language-go">x := 1
+</code></pre>
+</body></html>
+`)
+
+	resolveMap := map[string]string {
+		"posts/hello.md": "# {{title}} {{name}}\n\n| A |\n|---|\n| *b* |\n\n```go\nx := 1\n```",
+		"posts/hello.html": "wrong file",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestLayoutDirectiveUsage(t *testing.T) {
+	input := strings.TrimSpace(`
+@layout=layouts.sidebar
+@title=My Page
+<h1>{{title}}</h1>
+<v:sidebar><p>Links</p></v:sidebar>
+<p>Content</p>
+`)
+
+	expected := strings.TrimSpace(`
+<html><title>My Page</title><body><aside><p>Links</p></aside><main><h1>My Page</h1>
+
+<p>Content</p></main></body></html>
+`)
+
+	resolveMap := map[string]string {
+		"layouts/sidebar.html": "@layout=layouts.base\n<aside>{{sidebar}}</aside><main>{{content}}</main>",
+		"layouts/base.html": "<html><title>{{title}}</title><body>{{content}}</body></html>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestLayoutDirectiveDoesNotPassToChildTemplates(t *testing.T) {
+	input := strings.TrimSpace(`
+---
+layout: layout
+---
+<t:hello/>
+`)
+
+	expected := "<main><p>Hello</p></main>"
+
+	resolveMap := map[string]string {
+		"layout.html": "<main>{{content}}</main>",
+		"hello.html": "<p>Hello</p>",
+	}
+
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestComponentParamDefaults(t *testing.T) {
+	input := `<t:button size="large"/><t:button/>`
+	resolveMap := map[string]string{
+		"button.html": "@param:size=default=medium values=small|medium|large\n@param:label=default=\"Click here\"\n<button class=\"{{size}}\">{{label}}</button>",
+	}
+
+	expected := `<button class="large">Click here</button><button class="medium">Click here</button>`
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestComponentParamValidation(t *testing.T) {
+	opts := options.NewOptions()
+	parent := NewBuilder(strings.NewReader(""), opts, nil)
+	parent.path = "index.haste.html"
+
+	attrs := map[string][]byte{"hreff": []byte("/"), "size": []byte("huge"), "count": []byte("ten")}
+	tag := NewTemplateTag([]byte("parts.button"), attrs, opts, true)
+	tag.line = 3
+
+	input := "@param:href=required type=url\n@param:size=values=small|large\n@param:count=type=number\n<a></a>"
+	builder := NewBuilder(strings.NewReader(input), opts, parent)
+	builder.tag = tag
+	builder.parseHeader(bufio.NewScanner(builder.Reader))
+
+	var messages []string
+	for _, err := range builder.applyParams() {
+		messages = append(messages, err.Error())
+	}
+
+	expected := []string{
+		`index.haste.html:3: Invalid value "ten" for parameter "count", Expected a number on tag "parts.button"`,
+		`index.haste.html:3: Missing required parameter "href" on tag "parts.button"`,
+		`index.haste.html:3: Invalid value "huge" for parameter "size", Expected one of: small, large on tag "parts.button"`,
+		`index.haste.html:3: Unknown parameter "hreff" on tag "parts.button"`,
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf(buildResultErrorMessage(strings.Join(expected, "\n"), strings.Join(messages, "\n")))
+	}
+}
+
+func TestTemplateTagLineTracking(t *testing.T) {
+	opts := options.NewOptions()
+
+	input := "@title=Lines\n<p>"
+	builder := NewBuilder(strings.NewReader(input), opts, nil)
+	scanner := bufio.NewScanner(builder.Reader)
+	builder.parseHeader(scanner)
+	if builder.line != 2 {
+		t.Errorf("Expected content to start on line 2, Found line %d", builder.line)
+	}
+
+	r := builder.parseTemplateTags(strings.NewReader("<p>\nText\n</p>\n<t:a>"))
+	ioutil.ReadAll(r)
+	if builder.tagStack[0].line != 5 {
+		t.Errorf("Expected tag to be found on line 5, Found line %d", builder.tagStack[0].line)
+	}
+}
+
+func TestCircularIncludesAreNotBuilt(t *testing.T) {
+	input := `<t:a/>`
+	resolveMap := map[string]string{
+		"a.html": "<a><t:b/></a>",
+		"b.html": "<b><t:a/></b>",
+	}
+
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(resolveMap)
+	received, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+
+	expected := `<a><b></b></a>`
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+	if _, isBuildError := err.(*BuildError); !isBuildError {
+		t.Errorf("Expected a BuildError for a circular include, Got: %v", err)
+	}
+}
+
+func TestCircularIncludeChain(t *testing.T) {
+	opts := options.NewOptions()
+	page := NewBuilder(strings.NewReader(""), opts, nil)
+	page.path = "index.haste.html"
+
+	a := NewBuilder(strings.NewReader(""), opts, page)
+	a.path = "a.html"
+	a.tag = NewTemplateTag([]byte("a"), nil, opts, true)
+	fragment := NewBuilder(strings.NewReader(""), opts, a)
+	fragment.path = a.path
+	b := NewBuilder(strings.NewReader(""), opts, fragment)
+	b.path = "b.html"
+	b.tag = NewTemplateTag([]byte("b"), nil, opts, false)
+	aAgain := NewBuilder(strings.NewReader(""), opts, b)
+	aAgain.path = "a.html"
+	aAgain.tag = NewTemplateTag([]byte("a"), nil, opts, false)
+	aAgain.tag.line = 4
+
+	err := aAgain.checkRecursion()
+	expected := `b.html:4: Circular template include a.html -> b.html -> a.html on tag "a"`
+	if err == nil || err.Error() != expected {
+		t.Errorf(buildResultErrorMessage(expected, fmt.Sprint(err)))
+	}
+
+	if err := b.checkRecursion(); err != nil {
+		t.Errorf("Expected no error for non-circular include, Got: %s", err)
+	}
+}
+
+func TestRecursiveTemplatesBuildToMaxDepth(t *testing.T) {
+	input := `<t:tree name="a" next="b" after="c"/>`
+	resolveMap := map[string]string{
+		"tree.html": "@recursive=true\n<li>{{name}}<t:if var=\"next\"><t:tree name=\"{{next}}\" next=\"{{after}}\" after=\"\"/></t:if></li>",
+	}
+
+	expected := `<li>a<li>b<li>c</li></li></li>`
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(resolveMap)
+	opts.MaxRecursionDepth = 2
+	result, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+
+	expected = `<li>a<li>b</li></li>`
+	if result != expected {
+		t.Errorf(buildResultErrorMessage(expected, result))
+	}
+	if _, isBuildError := err.(*BuildError); !isBuildError {
+		t.Errorf("Expected a BuildError when exceeding the maximum recursion depth, Got: %v", err)
+	}
+}
+
+func TestBuildErrorsAreCollectedAsDiagnostics(t *testing.T) {
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"card.html": "<div>\n  <t:missing/></div>",
+	})
+
+	input := "@title=Hello\n<main>\n<t:card></t:card> <t:gone/>\n{{title | nope}}</main>"
+	builder := NewBuilder(strings.NewReader(input), opts, nil)
+	builder.path = "index.haste.html"
+	result, err := readBuild(builder)
+
+	expected := "<main>\n<div>\n  </div> \nHello</main>"
+	if result != expected {
+		t.Errorf(buildResultErrorMessage(expected, result))
+	}
+
+	buildErr, isBuildError := err.(*BuildError)
+	if !isBuildError || len(buildErr.Diagnostics) != 3 {
+		t.Errorf("Expected a BuildError with 3 diagnostics, Got: %v", err)
+	}
+
+	var messages []string
+	for _, d := range builder.Diagnostics.Items() {
+		messages = append(messages, d.Error()+" "+strings.Join(d.IncludeStack, ","))
+	}
+
+	expectedMessages := []string{
+		"card.html:2:3: Could not find tag with name \"missing\" at of the following locations:\nmissing.html index.haste.html",
+		"index.haste.html:3:19: Could not find tag with name \"gone\" at of the following locations:\ngone.html ",
+		"index.haste.html:4:1: Unknown filter \"nope\" in variable tag \"title | nope\" ",
+	}
+	if strings.Join(messages, "\n") != strings.Join(expectedMessages, "\n") {
+		t.Errorf(buildResultErrorMessage(strings.Join(expectedMessages, "\n"), strings.Join(messages, "\n")))
+	}
+}
+
+func TestStrayClosingTagsAreReported(t *testing.T) {
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"layout.html": "<main>{{content}}</main>",
+	})
+
+	cases := []struct {
+		input    string
+		expected string
+		message  string
+	}{
+		{"<p>A</p></t:card>\n<p>B</p>", "<p>A</p>\n<p>B</p>", "index.haste.html:1:9: Found a closing template tag without a matching opening tag"},
+		{"@layout=layout\n<p>A</p></t:card>\n<p>B</p>", "<main><p>A</p>\n<p>B</p></main>", "index.haste.html:2:9: Found a closing template tag without a matching opening tag"},
+		{"<p>A</p></v:title>", "<p>A</p>", "index.haste.html:1:9: Found a closing variable tag without a matching opening tag"},
+	}
+
+	for _, testCase := range cases {
+		builder := NewBuilder(strings.NewReader(testCase.input), opts, nil)
+		builder.path = "index.haste.html"
+		result, err := readBuild(builder)
+
+		if result != testCase.expected {
+			t.Errorf(buildResultErrorMessage(testCase.expected, result))
+		}
+		buildErr, isBuildError := err.(*BuildError)
+		if !isBuildError || len(buildErr.Diagnostics) != 1 || buildErr.Diagnostics[0].Error() != testCase.message {
+			t.Errorf("Expected a BuildError with message \"%s\", Got: %v", testCase.message, err)
+		}
+	}
+}
+
+// closeTrackingResolver resolves templates via a TestResolver,
+// counting the readers provided that have not been closed.
+type closeTrackingResolver struct {
+	resolver *loading.TestResolver
+	open     int32
+}
+
+type trackedReader struct {
+	io.Reader
+	resolver *closeTrackingResolver
+}
+
+func (r *closeTrackingResolver) GetTemplateReader(path string) (io.Reader, error) {
+	reader, err := r.resolver.GetTemplateReader(path)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&r.open, 1)
+	return &trackedReader{reader, r}, nil
+}
+
+func (r *trackedReader) Close() error {
+	atomic.AddInt32(&r.resolver.open, -1)
+	return nil
+}
+
+func TestTemplateReadersAreClosed(t *testing.T) {
+	resolver := &closeTrackingResolver{resolver: loading.NewTestResolver(map[string]string{
+		"card.html":      "<div>{{content}}</div><t:missing/>",
+		"logo.svg":       "<svg></svg>",
+		"styles.css":     "body {}",
+		"data/site.json": `{"title": "Site"}`,
+	})}
+	opts := options.NewOptions()
+	opts.TemplateResolver = resolver
+
+	input := "@data=data/site.json\n<t:card>{{site.title}}</t:card><t:logo.svg/><link href=\"{{asset 'styles.css'}}\">"
+	_, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+	buildErr, isBuildError := err.(*BuildError)
+	if !isBuildError {
+		t.Fatalf("Expected a BuildError, Got: %v", err)
+	}
+	for _, d := range buildErr.Diagnostics {
+		d.Format(resolver)
+	}
+
+	if open := atomic.LoadInt32(&resolver.open); open != 0 {
+		t.Errorf("Expected all template readers to be closed, %d left open", open)
+	}
+}
+
+func TestDiagnosticFormat(t *testing.T) {
+	resolver := loading.NewTestResolver(map[string]string{
+		"parts/card.html": "<div>\n\t<t:missing/>\n</div>",
+	})
+
+	d := &Diagnostic{
+		Severity:     SeverityError,
+		File:         "parts/card.html",
+		Line:         2,
+		Column:       2,
+		Message:      "Could not find tag",
+		IncludeStack: []string{"layout.html", "index.haste.html"},
+	}
+
+	expected := strings.Join([]string{
+		"parts/card.html:2:2: error: Could not find tag",
+		" 2 | \t<t:missing/>",
+		"   | \t^",
+		"    included from layout.html",
+		"    included from index.haste.html",
+	}, "\n")
+	if d.Format(resolver) != expected {
+		t.Errorf(buildResultErrorMessage(expected, d.Format(resolver)))
+	}
+
+	d.Severity = SeverityWarning
+	d.Line = 0
+	d.IncludeStack = nil
+	expected = "parts/card.html: warning: Could not find tag"
+	if d.Format(resolver) != expected {
+		t.Errorf(buildResultErrorMessage(expected, d.Format(resolver)))
+	}
+}
+
+func TestVariableErrorsAreReportedAtTheirPosition(t *testing.T) {
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"layout.html": "<main>{{content}}</main>",
+	})
+
+	input := strings.Join([]string{
+		"@layout=layout",
+		"@dates=soon,later",
+		"<p>",
+		"  {{title | truncate x}}</p>",
+		"<t:each items=\"dates\"><b>{{item | format 2006}}</b></t:each>",
+		"<img src=\"{{asset 'missing.png'}}\">",
+	}, "\n")
+	builder := NewBuilder(strings.NewReader(input), opts, nil)
+	builder.path = "index.haste.html"
+	_, err := readBuild(builder)
+	if err == nil {
+		t.Errorf("Expected variable errors to fail the build")
+	}
+
+	var messages []string
+	for _, d := range builder.Diagnostics.Items() {
+		messages = append(messages, d.Error())
+	}
+	sort.Strings(messages)
+
+	expected := []string{
+		`index.haste.html:4:3: Invalid truncate filter length "x" in variable tag "title | truncate x"`,
+		`index.haste.html:5:26: Could not parse "later" as a date for the format filter in variable tag "item | format 2006"`,
+		`index.haste.html:5:26: Could not parse "soon" as a date for the format filter in variable tag "item | format 2006"`,
+		`index.haste.html:6:11: Could not find asset "missing.png"`,
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf(buildResultErrorMessage(strings.Join(expected, "\n"), strings.Join(messages, "\n")))
+	}
+}
+
+func TestUndefinedVariablesAreReported(t *testing.T) {
+	opts := options.NewOptions()
+	opts.UndefinedVariables = options.UndefinedVariablesStrict
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"card.html": "<div title=\"{{label}}\">{{content}} {{missing}}</div>",
+	})
+
+	input := strings.Join([]string{
+		"@title=Hello",
+		"@pages=a,b",
+		"<h1>{{title}} {{titel}}</h1> {{subtitle ?? None}} @{{escaped}}",
+		"<t:card label=\"{{title}}\">{{title | upper}}</t:card>",
+		"<t:each items=\"pages\">{{item}} {{itme}}</t:each>",
+	}, "\n")
+	builder := NewBuilder(strings.NewReader(input), opts, nil)
+	builder.path = "index.haste.html"
+	_, err := readBuild(builder)
+
+	var messages []string
+	for _, d := range builder.Diagnostics.Items() {
+		messages = append(messages, d.Severity.String()+" "+d.Error())
+	}
+
+	expected := []string{
+		`error index.haste.html:3:15: Undefined variable "titel"`,
+		`error card.html:1:36: Undefined variable "missing"`,
+		`error index.haste.html:5:32: Undefined variable "itme"`,
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf(buildResultErrorMessage(strings.Join(expected, "\n"), strings.Join(messages, "\n")))
+	}
+	if err == nil {
+		t.Errorf("Expected undefined variables to fail the build in strict mode")
+	}
+
+	opts.UndefinedVariables = options.UndefinedVariablesWarn
+	builder = NewBuilder(strings.NewReader(input), opts, nil)
+	_, err = readBuild(builder)
+	if err != nil {
+		t.Errorf("Expected undefined variables not to fail the build in warn mode, Got: %s", err)
+	}
+	if len(builder.Diagnostics.Items()) != 3 || builder.Diagnostics.Items()[0].Severity != SeverityWarning {
+		t.Errorf("Expected undefined variables to be reported as warnings in warn mode")
+	}
+}
+
+func TestMultiLineHeaderVariables(t *testing.T) {
+	input := strings.Join([]string{
+		"@title=Home",
+		"@description<<<",
+		"A longer description",
+		"  spanning = lines",
+		">>>",
+		"@snippet <<<",
+		"<strong>Hello</strong>",
+		">>>",
+		"<meta content=\"{{description}}\">{{snippet}}",
+		"<t:child/>",
+	}, "\n")
+	resolveMap := map[string]string{
+		"child.html": "@description<<<\nChild description\n>>>\n<p>{{description}}</p>",
+	}
+
+	expected := "<meta content=\"A longer description\n  spanning = lines\"><strong>Hello</strong>\n<p>A longer description\n  spanning = lines</p>"
+	received := simpleBuild(t, input, resolveMap)
+	if received != expected {
+		t.Errorf(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestAttributeCaseModes(t *testing.T) {
+	input := `<t:counter startAt="5" step-size='2' Label=Count data-x="{{title}} startAt=1"/>`
+	resolveMap := map[string]string{
+		"counter.html": "{{startat}}|{{startAt}}|{{step-size}}|{{stepSize}}|{{label}}|{{Label}}|{{data-x}}|{{dataX}}",
+	}
+
+	tests := map[string]string{
+		options.AttributeCaseLower:    "5||2||Count||Home startAt=1|",
+		options.AttributeCasePreserve: "|5|2|||Count|Home startAt=1|",
+		options.AttributeCaseCamel:    "|5||2||Count||Home startAt=1",
+	}
+
+	for mode, expected := range tests {
+		opts := options.NewOptions()
+		opts.TemplateResolver = loading.NewTestResolver(resolveMap)
+		opts.AttributeCase = mode
+		builder := NewBuilder(strings.NewReader("@title=Home\n"+input), opts, nil)
+		received, err := readBuild(builder)
+		if err != nil {
+			t.Fatalf("Recieved error when reading build result; err: %s", err)
+		}
+		if received != expected {
+			t.Errorf("Mode %s: %s", mode, buildResultErrorMessage(expected, received))
+		}
+	}
+}
+
+func TestAttributeCaseDoesNotApplyToBuiltInTags(t *testing.T) {
+	opts := options.NewOptions()
+	opts.AttributeCase = options.AttributeCaseCamel
+	input := "@size=small\n<t:if var=\"size\" not-equals=\"large\">Not large</t:if>"
+
+	received, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+	if err != nil || received != "Not large" {
+		t.Errorf(buildResultErrorMessage("Not large", received))
+	}
+}
+
+func TestMinifyHTMLOutput(t *testing.T) {
+	opts := options.NewOptions()
+	opts.MinifyHTML = true
+	opts.MinifyCSS = true
+	opts.MinifyJS = true
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"styles.css": "/* Theme */\nbody {\n  color: red;\n  margin: 0 auto;\n}\n",
+	})
+	input := `<!DOCTYPE html>
+<html>
+    <head>
+        <!-- Page styles -->
+        <t:styles.css/>
+        <script>
+            // Greet
+            var greeting = "hello   world"; /* Say it */
+            alert(greeting)
+        </script>
+    </head>
+    <body>
+        <p>Some   <strong>bold</strong> <em>text</em>
+        here</p>
+        <pre>  keep
+    this </pre>
+        <textarea> as   is </textarea>
+    </body>
+</html>`
+	expected := `<!DOCTYPE html><html><head><style>body{color:red;margin:0 auto}</style><script>var greeting="hello   world";alert(greeting)</script></head><body><p>Some <strong>bold</strong> <em>text</em> here</p><pre>  keep
+    this </pre><textarea> as   is </textarea></body></html>`
+
+	received, err := readBuild(NewBuilder(strings.NewReader(input), opts, nil))
+	if err != nil {
+		t.Fatalf("Recieved error when reading build result; err: %s", err)
+	}
+	if received != expected {
+		t.Error(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	input := `a :hover, .b > .c { content: "a  ;  b" ; width: calc(100% - 2px) }
+@media screen and (max-width: 100px) { a{color:blue;} }`
+	expected := `a :hover,.b>.c{content:"a  ;  b";width:calc(100% - 2px)}@media screen and (max-width:100px){a{color:blue}}`
+
+	received := string(minifyCSS([]byte(input)))
+	if received != expected {
+		t.Error(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	input := `var a = b + +c; // Add
+var re = /[/]\/ +/g;
+var s = 'it\'s // not a comment';
+if (a) {
+    return a / 2
+}
+let url = ` + "`http://${s}`" + `
+x = y
+(z)`
+	expected := "var a=b+ +c;var re=/[/]\\/ +/g;var s='it\\'s // not a comment';if(a){return a/2}\nlet url=`http://${s}`\nx=y\n(z)"
+
+	received := string(minifyJS([]byte(input)))
+	if received != expected {
+		t.Error(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestSVGTagUsage(t *testing.T) {
+	input := `<t:images.logo.svg color="{{brand}}"/>`
+	resolveMap := map[string]string{
+		"images/logo.svg": "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<svg viewBox=\"0 0 10 10\"><linearGradient id=\"g\"/><rect fill=\"{{color}}\"/></svg>",
+	}
+	expected := `<svg viewBox="0 0 10 10"><linearGradient id="g"/><rect fill="#f00"/></svg>`
+
+	received := simpleBuild(t, "@brand=#f00\n"+input, resolveMap)
+	if received != expected {
+		t.Error(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestImageTagUsage(t *testing.T) {
+	input := `<t:images.icon.png alt="{{name}} & co" width="16"/>`
+	resolveMap := map[string]string{
+		"images/icon.png": "\x89PNG",
+	}
+	expected := `<img src="data:image/png;base64,iVBORw==" alt="Haste &amp; co" width="16">`
+
+	received := simpleBuild(t, "@name=Haste\n"+input, resolveMap)
+	if received != expected {
+		t.Error(buildResultErrorMessage(expected, received))
+	}
+}
+
+func TestAssetTagUsage(t *testing.T) {
+	opts := options.NewOptions()
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"css/styles.css": "body { color: red; }",
+		"logo.html":      `<img src="{{asset 'images/logo.png'}}">`,
+		"images/logo.png": "PNG",
+	})
+	input := `<link rel="stylesheet" href="{{asset "css/styles.css"}}"><t:logo/>{{asset "missing.js"}}`
+	expected := `<link rel="stylesheet" href="/css/styles.5de625c3.css"><img src="/images/logo.79612083.png">`
+
+	builder := NewBuilder(strings.NewReader(input), opts, nil)
+	received, err := readBuild(builder)
+	if received != expected {
+		t.Error(buildResultErrorMessage(expected, received))
+	}
+	if err == nil || !strings.Contains(err.Error(), `Could not find asset "missing.js"`) {
+		t.Errorf("Expected error for missing asset, Got: %v", err)
+	}
+
+	assets := builder.Assets.Items()
+	if len(assets) != 2 || assets[0].Path != filepath.FromSlash("css/styles.css") || string(assets[0].Content) != "body { color: red; }" {
+		t.Errorf("Expected referenced assets to be collected, Got: %v", assets)
+	}
+}
+
+func TestLargeImageTagUsage(t *testing.T) {
+	image := strings.Repeat("\x89PNG", 20*1024)
+	resolveMap := map[string]string{
+		"images/photo.png": image,
+	}
+	expected := `<p><img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString([]byte(image)) + `"></p>`
+
+	received := simpleBuild(t, "<p><t:images.photo.png/></p>", resolveMap)
+	if received != expected {
+		t.Errorf("Expected large image to be inlined, Recieved %d bytes", len(received))
+	}
+}
+
+func TestLargeMinifiedStylesheetTagUsage(t *testing.T) {
+	opts := options.NewOptions()
+	opts.MinifyCSS = true
+	css := strings.Repeat(".button {\n    color: red;\n}\n", 8*1024)
+	opts.TemplateResolver = loading.NewTestResolver(map[string]string{
+		"styles.css": css,
+	})
+	expected := "<style>\n" + strings.Repeat(".button{color:red}", 8*1024) + "\n</style>"
+
+	received, err := readBuild(NewBuilder(strings.NewReader("<t:styles.css/>"), opts, nil))
+	if err != nil {
+		t.Fatalf("Recieved error when reading build result; err: %s", err)
+	}
+	if received != expected {
+		t.Errorf("Expected large stylesheet to be minified and included, Recieved %d bytes", len(received))
+	}
+}
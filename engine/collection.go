@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectionRecords reads the header of a build file and, if it declares a
+// collection, provides a BuildFile for each record in the collection.
+// Returns nil if the build file does not declare a collection, or an
+// empty list if the declared collection has no records.
+func (m *Manager) collectionRecords(bf *BuildFile) ([]*BuildFile, error) {
+	header, err := m.readHeader(bf)
+	if err != nil || header.collection == nil {
+		return nil, err
+	}
+
+	if header.outputPattern == nil {
+		return nil, fmt.Errorf("Build file \"%s\" declares a collection but has no @output path pattern", bf.path)
+	}
+
+	records, err := header.loadCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	recordFiles := []*BuildFile{}
+	recordPaths := make(map[string]bool)
+	for _, recordVars := range records {
+		outPath, err := header.resolveOutputPath(recordVars)
+		if err != nil {
+			return nil, err
+		}
+		if recordPaths[outPath] {
+			return nil, fmt.Errorf("Multiple collection records resolve to the output path \"%s\"", outPath)
+		}
+		recordPaths[outPath] = true
+
+		record := NewBuildFile(bf.path)
+		record.vars = recordVars
+		record.outPath = outPath
+		recordFiles = append(recordFiles, record)
+	}
+
+	bf.includes = header.FilesParsed
+	return recordFiles, nil
+}
+
+// readHeader creates a builder that has only read the header of the given build file
+func (m *Manager) readHeader(bf *BuildFile) (*Builder, error) {
+	file, err := os.Open(filepath.Join(m.options.RootPath, bf.path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	builder := NewBuilder(file, m.options, nil)
+	builder.parseHeader(newLineScanner(file))
+	return builder, nil
+}
+
+// loadCollection reads the records of the collection data file set for this builder.
+// The collection can be a list nested within the data file by providing
+// its name after a '#', For example: "data/shop.json#products".
+func (b *Builder) loadCollection() ([]map[string][]byte, error) {
+	pathParts := strings.SplitN(string(b.collection), "#", 2)
+	path := filepath.Clean(filepath.FromSlash(strings.TrimSpace(pathParts[0])))
+
+	reader, err := b.Options.TemplateResolver.GetTemplateReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find collection data file \"%s\"", path)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	b.FilesParsed[path] = true
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := unmarshalData(content, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse collection data file \"%s\": %s", path, err)
+	}
+
+	if len(pathParts) == 2 {
+		data = dataFields(data)[strings.TrimSpace(pathParts[1])]
+	}
+
+	var items []interface{}
+	switch list := data.(type) {
+	case []interface{}:
+		items = list
+	case []map[string]interface{}:
+		for _, item := range list {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("Collection \"%s\" is not a list", b.collection)
+	}
+
+	var records []map[string][]byte
+	for _, item := range items {
+		recordVars := make(map[string][]byte)
+		fields := dataFields(item)
+		if len(fields) == 0 {
+			recordVars["item"] = []byte(dataValueToString(item))
+		}
+		for key, val := range fields {
+			flattenData(key, val, recordVars)
+		}
+		records = append(records, recordVars)
+	}
+
+	return records, nil
+}
+
+// resolveOutputPath provides the output path, relative to the output
+// directory, of a collection record with the given vars.
+func (b *Builder) resolveOutputPath(recordVars map[string][]byte) (string, error) {
+	vars := make(map[string][]byte)
+	for key, val := range b.Vars {
+		vars[key] = val
+	}
+	for key, val := range recordVars {
+		vars[key] = val
+	}
+
+	var resolveErr error
+	reportError := func(expression string, err error) {
+		resolveErr = err
+	}
+	outPath, err := ioutil.ReadAll(parseVariableTags(bytes.NewReader(b.outputPattern), vars, b.Options, true, nil, nil, reportError))
+	if err != nil {
+		return "", err
+	}
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+
+	cleanPath := filepath.Clean(filepath.FromSlash(string(outPath)))
+	if filepath.IsAbs(cleanPath) || strings.HasPrefix(cleanPath, "..") {
+		return "", fmt.Errorf("Collection output path \"%s\" must be within the output directory", outPath)
+	}
+
+	fileName := strings.TrimSuffix(filepath.Base(cleanPath), filepath.Ext(cleanPath))
+	if cleanPath == "." || fileName == "" {
+		return "", fmt.Errorf("Collection output path \"%s\" has an empty file name, Check the variables used in the @output pattern", outPath)
+	}
+	return cleanPath, nil
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const paramDirectivePrefix = "param:"
+
+// componentParam is a parameter declared by a template via a header line
+// such as "@param:size=required values=small|large".
+type componentParam struct {
+	name          string
+	required      bool
+	defaultVal    []byte
+	hasDefault    bool
+	valueType     string
+	allowedValues []string
+}
+
+// parseComponentParam reads the options of a parameter declaration.
+func parseComponentParam(name string, spec []byte) (*componentParam, error) {
+	param := &componentParam{name: name}
+
+	for _, option := range paramOptions(string(spec)) {
+		optionParts := strings.SplitN(option, "=", 2)
+		key := optionParts[0]
+		val := ""
+		if len(optionParts) == 2 {
+			val = optionParts[1]
+		}
+
+		switch key {
+		case "required":
+			param.required = true
+		case "optional":
+			param.required = false
+		case "default":
+			param.defaultVal = []byte(val)
+			param.hasDefault = true
+		case "type":
+			if val != "text" && val != "number" && val != "url" {
+				return nil, fmt.Errorf("Unknown type \"%s\" for parameter \"%s\", Expected text, number or url", val, name)
+			}
+			param.valueType = val
+		case "values":
+			param.allowedValues = strings.Split(val, "|")
+		default:
+			return nil, fmt.Errorf("Unknown option \"%s\" for parameter \"%s\"", key, name)
+		}
+	}
+
+	return param, nil
+}
+
+// paramOptions splits a parameter declaration into its space separated options.
+// Option values can be wrapped in quotes to contain spaces.
+func paramOptions(spec string) []string {
+	var options []string
+	var option strings.Builder
+	var quote rune
+
+	for _, char := range spec {
+		if quote != 0 && char == quote {
+			quote = 0
+		} else if quote == 0 && (char == '"' || char == '\'') {
+			quote = char
+		} else if quote == 0 && char == ' ' {
+			if option.Len() > 0 {
+				options = append(options, option.String())
+			}
+			option.Reset()
+		} else {
+			option.WriteRune(char)
+		}
+	}
+
+	if option.Len() > 0 {
+		options = append(options, option.String())
+	}
+	return options
+}
+
+// validate checks the given value against the type and allowed values of this parameter.
+func (p *componentParam) validate(val []byte) error {
+	strVal := string(bytes.TrimSpace(val))
+
+	if len(p.allowedValues) > 0 {
+		allowed := false
+		for _, allowedValue := range p.allowedValues {
+			allowed = allowed || strVal == allowedValue
+		}
+		if !allowed {
+			return fmt.Errorf("Invalid value \"%s\" for parameter \"%s\", Expected one of: %s", strVal, p.name, strings.Join(p.allowedValues, ", "))
+		}
+	}
+
+	if p.valueType == "number" {
+		if _, err := strconv.ParseFloat(strVal, 64); err != nil {
+			return fmt.Errorf("Invalid value \"%s\" for parameter \"%s\", Expected a number", strVal, p.name)
+		}
+	}
+
+	if p.valueType == "url" {
+		if _, err := url.Parse(strVal); err != nil || !isSafeURL(strVal) {
+			return fmt.Errorf("Invalid value \"%s\" for parameter \"%s\", Expected a URL", strVal, p.name)
+		}
+	}
+
+	return nil
+}
+
+// applyParams validates the attributes passed to this builder's template tag
+// against the parameters declared in its header and sets any default values.
+// Returns an error for each problem found, located at the calling tag.
+func (b *Builder) applyParams() []error {
+	if len(b.params) == 0 {
+		return nil
+	}
+
+	var attrs map[string][]byte
+	if b.tag != nil {
+		attrs = b.tag.attrs
+	}
+
+	var errs []error
+	for _, name := range sortedParamNames(b.params) {
+		param := b.params[name]
+		val, passed := attrs[name]
+
+		if !passed && param.hasDefault {
+			b.addHeaderVars(map[string][]byte{name: param.defaultVal})
+		}
+
+		if b.tag == nil {
+			continue
+		}
+
+		if !passed && param.required {
+			errs = append(errs, b.callerError("Missing required parameter \"%s\"", name))
+		} else if passed {
+			if err := param.validate(val); err != nil {
+				errs = append(errs, b.callerError("%s", err))
+			}
+		}
+	}
+
+	for _, name := range sortedAttrNames(attrs) {
+		paramName := strings.SplitN(name, ".", 2)[0]
+		if _, declared := b.params[paramName]; !declared && !strings.HasPrefix(name, ":") {
+			errs = append(errs, b.callerError("Unknown parameter \"%s\"", name))
+		}
+	}
+
+	return errs
+}
+
+// callerError creates an error located at the tag that called this builder.
+func (b *Builder) callerError(format string, a ...interface{}) error {
+	message := fmt.Sprintf(format, a...) + fmt.Sprintf(" on tag \"%s\"", b.tag.name)
+	caller := b.parent
+	if caller == nil {
+		caller = b
+	}
+	return caller.diagnostic(SeverityError, b.tag.line, b.tag.column, message)
+}
+
+func sortedParamNames(params map[string]*componentParam) []string {
+	var names []string
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedAttrNames(attrs map[string][]byte) []string {
+	var names []string
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
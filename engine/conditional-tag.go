@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/ssddanbrown/haste/options"
+)
+
+var (
+	conditionalTagName = []byte("if")
+	elseTagName        = []byte("else")
+)
+
+func NewConditionalTag(attrs map[string][]byte, opts *options.Options) *templateTag {
+	tag := &templateTag{
+		name:    conditionalTagName,
+		attrs:   attrs,
+		tagType: "conditional",
+		options: opts,
+	}
+	return tag
+}
+
+// conditionMet checks the attributes of a conditional tag against the given vars.
+// Without any tests a condition is met if the variable exists and is not empty.
+func (t *templateTag) conditionMet(vars map[string][]byte) bool {
+	value := bytes.TrimSpace(vars[string(t.attrs["var"])])
+
+	if expected, ok := t.attrs["equals"]; ok {
+		return bytes.Equal(value, bytes.TrimSpace(expected))
+	}
+
+	if expected, ok := t.attrs["not-equals"]; ok {
+		return !bytes.Equal(value, bytes.TrimSpace(expected))
+	}
+
+	if _, ok := t.attrs["empty"]; ok {
+		return len(value) == 0
+	}
+
+	return len(value) > 0
+}
+
+// chosenContent provides the raw content of the branch to use
+// for the given vars.
+func (t *templateTag) chosenContent(vars map[string][]byte) []byte {
+	if t.conditionMet(vars) {
+		return t.injectedContent
+	}
+	return t.elseContent
+}
+
+// chosenPosition provides the line and column that the chosen branch content starts at.
+func (t *templateTag) chosenPosition(vars map[string][]byte) (int, int) {
+	if t.conditionMet(vars) {
+		return t.line, t.column
+	}
+	return t.elseLine, t.elseColumn
+}
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// loadDataFile reads the JSON, YAML or TOML file at the given path,
+// relative to the root path, and adds its contents as variables
+// named after the file. For example, a "lead.name" value within
+// "data/team.json" would be available as "team.lead.name".
+func (b *Builder) loadDataFile(path string) error {
+	path = filepath.Clean(filepath.FromSlash(strings.TrimSpace(path)))
+	reader, err := b.Options.TemplateResolver.GetTemplateReader(path)
+	if err != nil {
+		return fmt.Errorf("Could not find data file \"%s\"", path)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	b.FilesParsed[path] = true
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	data, err := unmarshalData(content, filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("Could not parse data file \"%s\": %s", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	dataVars := make(map[string][]byte)
+	flattenData(name, data, dataVars)
+	b.addHeaderVars(dataVars)
+
+	return nil
+}
+
+func unmarshalData(content []byte, ext string) (interface{}, error) {
+	var data interface{}
+	var err error
+
+	switch ext {
+	case ".json":
+		err = json.Unmarshal(content, &data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &data)
+	case ".toml":
+		tomlData := make(map[string]interface{})
+		_, err = toml.Decode(string(content), &tomlData)
+		data = tomlData
+	default:
+		err = fmt.Errorf("Unsupported data file type \"%s\"", ext)
+	}
+
+	return data, err
+}
+
+// flattenData adds the given data to vars using dot separated names.
+// Lists are added as indexed variables, such as "team.members.0",
+// with each item always being set so lists can be looped over.
+func flattenData(name string, data interface{}, vars map[string][]byte) {
+	switch val := data.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			flattenData(name+"."+key, item, vars)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range val {
+			flattenData(name+"."+fmt.Sprint(key), item, vars)
+		}
+	case []interface{}:
+		for i, item := range val {
+			flattenListItem(name+"."+strconv.Itoa(i), item, vars)
+		}
+	case []map[string]interface{}:
+		for i, item := range val {
+			flattenListItem(name+"."+strconv.Itoa(i), item, vars)
+		}
+	default:
+		vars[name] = []byte(dataValueToString(val))
+	}
+}
+
+func flattenListItem(name string, item interface{}, vars map[string][]byte) {
+	vars[name] = []byte{}
+	flattenData(name, item, vars)
+}
+
+func dataValueToString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(val)
+}
+
+// dataFields provides the top level fields of parsed data
+func dataFields(data interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	switch d := data.(type) {
+	case map[string]interface{}:
+		fields = d
+	case map[interface{}]interface{}:
+		for key, val := range d {
+			fields[fmt.Sprint(key)] = val
+		}
+	}
+	return fields
+}
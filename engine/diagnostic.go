@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ssddanbrown/haste/loading"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// A Diagnostic is a problem found while building, located at a position
+// within a file. Line and Column are 1-based and are 0 if unknown.
+type Diagnostic struct {
+	Severity Severity
+	File     string
+	Line     int
+	Column   int
+	Message  string
+
+	// Paths of the files that included File, innermost first
+	IncludeStack []string
+}
+
+// Location provides the position of the diagnostic in "file:line:col" format.
+func (d *Diagnostic) Location() string {
+	location := d.File
+	if location == "" {
+		location = "<input>"
+	}
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line)
+	}
+	if d.Line > 0 && d.Column > 0 {
+		location += ":" + strconv.Itoa(d.Column)
+	}
+	return location
+}
+
+func (d *Diagnostic) Error() string {
+	return d.Location() + ": " + d.Message
+}
+
+// Format provides a compiler-style description of the diagnostic including
+// a snippet of the offending source, read via the given resolver, and the
+// files that included it.
+func (d *Diagnostic) Format(resolver loading.TemplateResolver) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s: %s: %s", d.Location(), d.Severity, d.Message)
+
+	if sourceLine, ok := d.sourceLine(resolver); ok {
+		lineNumber := strconv.Itoa(d.Line)
+		gutter := strings.Repeat(" ", len(lineNumber))
+		fmt.Fprintf(&out, "\n %s | %s", lineNumber, sourceLine)
+		if d.Column > 0 && d.Column <= len(sourceLine)+1 {
+			fmt.Fprintf(&out, "\n %s | %s^", gutter, markerIndent(sourceLine[:d.Column-1]))
+		}
+	}
+
+	for _, path := range d.IncludeStack {
+		fmt.Fprintf(&out, "\n    included from %s", path)
+	}
+
+	return out.String()
+}
+
+func (d *Diagnostic) sourceLine(resolver loading.TemplateResolver) (string, bool) {
+	if resolver == nil || d.File == "" || d.Line < 1 {
+		return "", false
+	}
+
+	reader, err := resolver.GetTemplateReader(d.File)
+	if err != nil {
+		return "", false
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	scanner := newLineScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		if line == d.Line {
+			return scanner.Text(), true
+		}
+	}
+	return "", false
+}
+
+// markerIndent provides whitespace matching the width of the given
+// source, keeping tabs so that the marker lines up.
+func markerIndent(source string) string {
+	var indent strings.Builder
+	for _, char := range source {
+		if char == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	return indent.String()
+}
+
+// DiagnosticList collects the diagnostics found across a build.
+// It's safe for use by the concurrently running stages of a build.
+type DiagnosticList struct {
+	mutex    sync.Mutex
+	items    []*Diagnostic
+	reported map[string]bool
+}
+
+func (l *DiagnosticList) Add(d *Diagnostic) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.items = append(l.items, d)
+}
+
+// AddOnce adds the given diagnostic unless one with the same message has
+// already been added for the same source position, such as for content
+// that's built multiple times within a loop.
+func (l *DiagnosticList) AddOnce(d *Diagnostic) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := fmt.Sprintf("%s:%d:%d:%s", d.File, d.Line, d.Column, d.Message)
+	if l.reported[key] {
+		return
+	}
+	if l.reported == nil {
+		l.reported = make(map[string]bool)
+	}
+	l.reported[key] = true
+	l.items = append(l.items, d)
+}
+
+// Items provides a copy of the diagnostics collected so far.
+func (l *DiagnosticList) Items() []*Diagnostic {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*Diagnostic(nil), l.items...)
+}
+
+// A BuildError is returned when a build has found errors, or warnings if
+// treating warnings as errors. Details of each are held as diagnostics.
+type BuildError struct {
+	File        string
+	Diagnostics []*Diagnostic
+}
+
+func (e *BuildError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "<input>"
+	}
+	if len(e.Diagnostics) == 1 {
+		return fmt.Sprintf("Build of \"%s\" failed: %s", file, e.Diagnostics[0])
+	}
+	return fmt.Sprintf("Build of \"%s\" failed with %d errors", file, len(e.Diagnostics))
+}
+
+// failingDiagnostics provides the diagnostics that should cause a build to fail.
+func failingDiagnostics(diagnostics []*Diagnostic, warningsAsErrors bool) []*Diagnostic {
+	var failing []*Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError || warningsAsErrors {
+			failing = append(failing, d)
+		}
+	}
+	return failing
+}
+
+// buildError provides a BuildError if errors have been found in this build.
+func (b *Builder) buildError() error {
+	failing := failingDiagnostics(b.Diagnostics.Items(), b.Options.WarningsAsErrors)
+	if len(failing) == 0 {
+		return nil
+	}
+	return &BuildError{File: b.path, Diagnostics: failing}
+}
+
+// diagnostic creates a diagnostic located at the given position of this builder's content.
+func (b *Builder) diagnostic(severity Severity, line int, column int, message string) *Diagnostic {
+	var includeStack []string
+	chain := b.includeChain()
+	for i := len(chain) - 2; i >= 0; i-- {
+		includeStack = append(includeStack, chain[i])
+	}
+
+	return &Diagnostic{
+		Severity:     severity,
+		File:         b.path,
+		Line:         line,
+		Column:       column,
+		Message:      message,
+		IncludeStack: includeStack,
+	}
+}
+
+// addError adds the given error to the diagnostics of this build, located at the
+// given position unless the error is already a diagnostic with its own position.
+func (b *Builder) addError(line int, column int, err error) {
+	d, ok := err.(*Diagnostic)
+	if !ok {
+		d = b.diagnostic(SeverityError, line, column, err.Error())
+	}
+	b.Diagnostics.Add(d)
+}
+
+// errorReporter provides a function that adds errors at the given position.
+func (b *Builder) errorReporter(line int, column int) func(error) {
+	return func(err error) {
+		b.addError(line, column, err)
+	}
+}
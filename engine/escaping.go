@@ -0,0 +1,356 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+const (
+	contextText = iota
+	contextTagOpen
+	contextTagName
+	contextMarkup
+	contextComment
+	contextTag
+	contextAttrName
+	contextAfterAttrName
+	contextBeforeAttrValue
+	contextAttrValue
+	contextRawText
+)
+
+// Attributes that have their values escaped as URLs
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"cite":       true,
+	"poster":     true,
+	"background": true,
+	"data":       true,
+}
+
+// URL schemes allowed at the start of URL attribute values
+var safeURLSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"tel":    true,
+}
+
+// htmlContext tracks where in a HTML document the content written so far ends,
+// such as within text, a tag attribute or a script, so that variable values
+// output at that point can be escaped to suit.
+type htmlContext struct {
+	state     int
+	tagName   []byte
+	endTag    bool
+	attrName  []byte
+	attrValue []byte
+	quote     byte
+	rawTag    []byte
+	recent    []byte
+	js        jsContext
+}
+
+// jsContext tracks whether the JavaScript written so far ends within
+// a string literal, skipping over any comments.
+type jsContext struct {
+	quote   byte
+	escaped bool
+	comment byte
+	prev    byte
+}
+
+// newHTMLContext creates a context starting within HTML text or,
+// if a contentType of "css" or "js" is given, within a style or script.
+func newHTMLContext(contentType string) *htmlContext {
+	c := &htmlContext{}
+	if contentType == "css" {
+		c.state = contextRawText
+		c.rawTag = []byte("style")
+	} else if contentType == "js" {
+		c.state = contextRawText
+		c.rawTag = []byte("script")
+	}
+	return c
+}
+
+func (j *jsContext) Feed(content []byte) {
+	for _, char := range content {
+		j.feedByte(char)
+	}
+}
+
+func (j *jsContext) feedByte(char byte) {
+	prev := j.prev
+	j.prev = char
+
+	switch {
+	case j.comment == '/':
+		if char == '\n' {
+			j.comment = 0
+		}
+	case j.comment == '*':
+		if prev == '*' && char == '/' {
+			j.comment = 0
+			j.prev = 0
+		}
+	case j.quote != 0:
+		if j.escaped {
+			j.escaped = false
+		} else if char == '\\' {
+			j.escaped = true
+		} else if char == j.quote {
+			j.quote = 0
+		}
+	case prev == '/' && (char == '/' || char == '*'):
+		j.comment = char
+		j.prev = 0
+	case char == '"' || char == '\'' || char == '`':
+		j.quote = char
+	}
+}
+
+func (c *htmlContext) Feed(content []byte) {
+	for _, char := range content {
+		c.feedByte(char)
+	}
+}
+
+func (c *htmlContext) feedByte(char byte) {
+	isSpace := char == ' ' || char == '\n' || char == '\r' || char == '\t' || char == '\f'
+
+	switch c.state {
+	case contextText:
+		if char == '<' {
+			c.state = contextTagOpen
+		}
+	case contextTagOpen:
+		c.endTag = char == '/'
+		c.tagName = c.tagName[:0]
+		if char == '!' {
+			c.state = contextMarkup
+			c.recent = c.recent[:0]
+		} else if c.endTag {
+			c.state = contextTagName
+		} else if isASCIILetter(char) {
+			c.tagName = append(c.tagName, toLower(char))
+			c.state = contextTagName
+		} else {
+			c.state = contextText
+		}
+	case contextMarkup:
+		c.recent = append(c.recent, char)
+		if bytes.Equal(c.recent, []byte("--")) {
+			c.state = contextComment
+			c.recent = c.recent[:0]
+		} else if char == '>' {
+			c.state = contextText
+		}
+	case contextComment:
+		c.recent = appendRecent(c.recent, char, 3)
+		if bytes.Equal(c.recent, []byte("-->")) {
+			c.state = contextText
+		}
+	case contextTagName:
+		if isSpace || char == '/' {
+			c.state = contextTag
+		} else if char == '>' {
+			c.endOfTag()
+		} else {
+			c.tagName = append(c.tagName, toLower(char))
+		}
+	case contextTag:
+		if char == '>' {
+			c.endOfTag()
+		} else if !isSpace && char != '/' {
+			c.attrName = append(c.attrName[:0], toLower(char))
+			c.state = contextAttrName
+		}
+	case contextAttrName:
+		if char == '=' {
+			c.state = contextBeforeAttrValue
+		} else if char == '>' {
+			c.endOfTag()
+		} else if isSpace || char == '/' {
+			c.state = contextAfterAttrName
+		} else {
+			c.attrName = append(c.attrName, toLower(char))
+		}
+	case contextAfterAttrName:
+		if char == '=' {
+			c.state = contextBeforeAttrValue
+		} else if char == '>' {
+			c.endOfTag()
+		} else if !isSpace && char != '/' {
+			c.attrName = append(c.attrName[:0], toLower(char))
+			c.state = contextAttrName
+		}
+	case contextBeforeAttrValue:
+		c.attrValue = c.attrValue[:0]
+		if char == '"' || char == '\'' {
+			c.quote = char
+			c.state = contextAttrValue
+		} else if char == '>' {
+			c.endOfTag()
+		} else if !isSpace {
+			c.quote = 0
+			c.attrValue = append(c.attrValue, char)
+			c.state = contextAttrValue
+		}
+	case contextAttrValue:
+		if (c.quote != 0 && char == c.quote) || (c.quote == 0 && isSpace) {
+			c.state = contextTag
+		} else if c.quote == 0 && char == '>' {
+			c.endOfTag()
+		} else {
+			c.attrValue = append(c.attrValue, char)
+		}
+	case contextRawText:
+		if bytes.Equal(c.rawTag, []byte("script")) {
+			c.js.feedByte(char)
+		}
+		closing := append([]byte("</"), c.rawTag...)
+		c.recent = appendRecent(c.recent, toLower(char), len(closing))
+		if bytes.Equal(c.recent, closing) {
+			c.endTag = true
+			c.tagName = append(c.tagName[:0], c.rawTag...)
+			c.state = contextTagName
+		}
+	}
+}
+
+func (c *htmlContext) endOfTag() {
+	isRawTag := bytes.Equal(c.tagName, []byte("script")) || bytes.Equal(c.tagName, []byte("style"))
+	if isRawTag && !c.endTag {
+		c.state = contextRawText
+		c.rawTag = append(c.rawTag[:0], c.tagName...)
+		c.recent = c.recent[:0]
+		c.js = jsContext{}
+		return
+	}
+	c.state = contextText
+}
+
+// Escape escapes the given value for output at the current position.
+func (c *htmlContext) Escape(val []byte) []byte {
+	strVal := string(val)
+
+	switch c.state {
+	case contextRawText:
+		if bytes.Equal(c.rawTag, []byte("style")) {
+			return []byte(escapeCSS(strVal))
+		}
+		return []byte(escapeJS(strVal, c.js))
+	case contextAttrValue, contextBeforeAttrValue:
+		attrName := string(c.attrName)
+		if strings.HasPrefix(attrName, "on") {
+			var js jsContext
+			if c.state == contextAttrValue {
+				js.Feed([]byte(html.UnescapeString(string(c.attrValue))))
+			}
+			return []byte(html.EscapeString(escapeJS(strVal, js)))
+		}
+		if attrName == "style" {
+			return []byte(html.EscapeString(escapeCSS(strVal)))
+		}
+		if urlAttributes[attrName] {
+			return []byte(html.EscapeString(c.escapeURL(strVal)))
+		}
+	}
+
+	return []byte(html.EscapeString(strVal))
+}
+
+// escapeURL escapes a value used within a URL attribute. Values at the start of the
+// URL are checked for unsafe schemes while values within a query are encoded.
+func (c *htmlContext) escapeURL(val string) string {
+	if c.state == contextBeforeAttrValue || len(bytes.TrimSpace(c.attrValue)) == 0 {
+		if !isSafeURL(val) {
+			return "about:invalid"
+		}
+		return val
+	}
+
+	if bytes.ContainsAny(c.attrValue, "?#") {
+		return url.QueryEscape(val)
+	}
+	return val
+}
+
+func isSafeURL(val string) bool {
+	val = strings.TrimSpace(val)
+	schemeEnd := strings.IndexAny(val, ":/?#")
+	if schemeEnd < 0 || val[schemeEnd] != ':' {
+		return true
+	}
+	return safeURLSchemes[strings.ToLower(val[:schemeEnd])]
+}
+
+// escapeJS escapes a value used within JavaScript. Values within a string
+// literal are escaped to suit while values elsewhere, including comments,
+// are output as a quoted string so they cannot be run as code.
+func escapeJS(val string, js jsContext) string {
+	if js.quote == 0 {
+		encoded, _ := json.Marshal(val)
+		return strings.ReplaceAll(string(encoded), "/", "\\/")
+	}
+
+	escaped := template.JSEscapeString(val)
+	if js.quote == '`' {
+		escaped = strings.NewReplacer("`", "\\u0060", "$", "\\u0024").Replace(escaped)
+	}
+	return escaped
+}
+
+func escapeCSS(val string) string {
+	var escaped strings.Builder
+	for _, char := range val {
+		isSafe := char > 127 || isASCIILetter(byte(char)) || (char >= '0' && char <= '9') || strings.ContainsRune(" #.,%_-()/+!", char)
+		if isSafe {
+			escaped.WriteRune(char)
+		} else {
+			fmt.Fprintf(&escaped, "\\%x ", char)
+		}
+	}
+	return escaped.String()
+}
+
+func isASCIILetter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func toLower(char byte) byte {
+	if char >= 'A' && char <= 'Z' {
+		return char + 'a' - 'A'
+	}
+	return char
+}
+
+func appendRecent(recent []byte, char byte, max int) []byte {
+	recent = append(recent, char)
+	if len(recent) > max {
+		recent = recent[len(recent)-max:]
+	}
+	return recent
+}
+
+// contextWriter passes all written content through to the
+// underlying writer while tracking the HTML context.
+type contextWriter struct {
+	w       io.Writer
+	context *htmlContext
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	cw.context.Feed(p)
+	return cw.w.Write(p)
+}
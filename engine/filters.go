@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// A Filter transforms the value of a variable when output via a variable tag.
+// Filters are applied in order using a pipe syntax with any arguments
+// following the filter name. For example: {{text | truncate 80 | upper}}
+type Filter func(val []byte, args []string) ([]byte, error)
+
+// The raw filter marks a value to be output without any auto-escaping
+const rawFilterName = "raw"
+
+// Lock guarding the filters, which may be registered while builds are running
+var filtersLock sync.RWMutex
+
+var filters = map[string]Filter{
+	rawFilterName: rawFilter,
+	"upper":       upperFilter,
+	"lower":       lowerFilter,
+	"trim":        trimFilter,
+	"escape":      escapeFilter,
+	"urlencode":   urlEncodeFilter,
+	"format":      formatFilter,
+	"truncate":    truncateFilter,
+}
+
+// Date layouts that variable values will be parsed as when using the format filter
+var filterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// RegisterFilter adds a filter that can be used within variable tags,
+// replacing any existing filter with the same name.
+// It's safe to register filters while builds are running.
+func RegisterFilter(name string, filter Filter) {
+	filtersLock.Lock()
+	defer filtersLock.Unlock()
+	filters[name] = filter
+}
+
+func applyFilter(name string, val []byte, args []string) ([]byte, error) {
+	filtersLock.RLock()
+	filter, ok := filters[name]
+	filtersLock.RUnlock()
+	if !ok {
+		return val, fmt.Errorf("Unknown filter \"%s\"", name)
+	}
+	return filter(val, args)
+}
+
+func rawFilter(val []byte, args []string) ([]byte, error) {
+	return val, nil
+}
+
+func upperFilter(val []byte, args []string) ([]byte, error) {
+	return bytes.ToUpper(val), nil
+}
+
+func lowerFilter(val []byte, args []string) ([]byte, error) {
+	return bytes.ToLower(val), nil
+}
+
+func trimFilter(val []byte, args []string) ([]byte, error) {
+	return bytes.TrimSpace(val), nil
+}
+
+func escapeFilter(val []byte, args []string) ([]byte, error) {
+	return []byte(html.EscapeString(string(val))), nil
+}
+
+func urlEncodeFilter(val []byte, args []string) ([]byte, error) {
+	return []byte(url.QueryEscape(string(val))), nil
+}
+
+func formatFilter(val []byte, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return val, errors.New("The format filter requires a single layout argument")
+	}
+
+	strVal := string(bytes.TrimSpace(val))
+	for _, layout := range filterDateLayouts {
+		date, err := time.Parse(layout, strVal)
+		if err == nil {
+			return []byte(date.Format(args[0])), nil
+		}
+	}
+
+	return val, fmt.Errorf("Could not parse \"%s\" as a date for the format filter", strVal)
+}
+
+func truncateFilter(val []byte, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return val, errors.New("The truncate filter requires a length argument")
+	}
+
+	length, err := strconv.Atoi(args[0])
+	if err != nil || length < 0 {
+		return val, fmt.Errorf("Invalid truncate filter length \"%s\"", args[0])
+	}
+
+	suffix := "..."
+	if len(args) > 1 {
+		suffix = args[1]
+	}
+
+	if utf8.RuneCount(val) <= length {
+		return val, nil
+	}
+
+	truncated := []rune(string(val))[:length]
+	return []byte(string(truncated) + suffix), nil
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+)
+
+// Front matter delimiters mapped to the data format used within them
+var frontMatterFormats = map[string]string{
+	"---": ".yaml",
+	"+++": ".toml",
+}
+
+func isFrontMatterDelimiter(line []byte) bool {
+	_, ok := frontMatterFormats[string(bytes.TrimSpace(line))]
+	return ok
+}
+
+// parseFrontMatter reads a block of YAML or TOML front matter, starting at the
+// current line of the scanner, and adds its values as variables.
+// Directive values, such as "data" or "layout", are used in the same way as
+// their "@" header lines.
+func (b *Builder) parseFrontMatter(scanner *bufio.Scanner) error {
+	delimiter := string(bytes.TrimSpace(scanner.Bytes()))
+
+	var content []byte
+	closed := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if string(bytes.TrimSpace(line)) == delimiter {
+			closed = true
+			break
+		}
+		content = append(content, line...)
+		content = append(content, '\n')
+	}
+
+	if !closed {
+		return fmt.Errorf("Front matter started with \"%s\" was not closed", delimiter)
+	}
+
+	data, err := unmarshalData(content, frontMatterFormats[delimiter])
+	if err != nil {
+		return fmt.Errorf("Could not parse front matter: %s", err)
+	}
+
+	vars := make(map[string][]byte)
+	for key, val := range dataFields(data) {
+		if key == "data" {
+			err = b.loadFrontMatterDataFiles(val)
+			continue
+		}
+
+		isDirective, directiveErr := b.parseHeaderDirective(key, []byte(dataValueToString(val)))
+		if directiveErr != nil {
+			err = directiveErr
+		}
+		if !isDirective {
+			flattenData(key, val, vars)
+		}
+	}
+
+	b.addHeaderVars(vars)
+	return err
+}
+
+func (b *Builder) loadFrontMatterDataFiles(paths interface{}) error {
+	var err error
+	pathList, isList := paths.([]interface{})
+	if !isList {
+		pathList = []interface{}{paths}
+	}
+
+	for _, path := range pathList {
+		loadErr := b.loadDataFile(dataValueToString(path))
+		if loadErr != nil {
+			err = loadErr
+		}
+	}
+	return err
+}
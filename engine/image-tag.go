@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/net/html"
+)
+
+// Extensions of raster images that can be inlined via template tags
+var imageExtensions = []string{"png", "jpg", "jpeg", "gif", "webp", "ico"}
+
+var imageMimeTypes = map[string]string{
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"ico":  "image/x-icon",
+}
+
+func isImageType(contentType string) bool {
+	_, ok := imageMimeTypes[contentType]
+	return ok
+}
+
+// imageTag provides an img tag using the image data of the given reader as
+// a data URI source, along with any attributes set on the template tag.
+func (t *templateTag) imageTag(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(`<img src="data:`)
+	out.WriteString(imageMimeTypes[t.contentType])
+	out.WriteString(";base64,")
+	out.WriteString(base64.StdEncoding.EncodeToString(data))
+	out.WriteString(`"`)
+
+	for _, attr := range t.htmlAttrs {
+		if attr.Key == "src" || attr.Key == ":name" {
+			continue
+		}
+		out.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	out.WriteString(">")
+
+	return out.Bytes(), nil
+}
+
+// trimXMLProlog removes any XML declaration and doctype from the start of
+// the given SVG content, since they're not valid when used within HTML.
+func trimXMLProlog(content []byte) []byte {
+	for {
+		content = bytes.TrimLeft(content, " \t\r\n")
+		isDoctype := len(content) >= 9 && bytes.EqualFold(content[:9], []byte("<!DOCTYPE"))
+		if !bytes.HasPrefix(content, []byte("<?xml")) && !isDoctype {
+			return content
+		}
+		end := bytes.IndexByte(content, '>')
+		if end < 0 {
+			return content
+		}
+		content = content[end+1:]
+	}
+}
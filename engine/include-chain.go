@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// includeChain provides the paths of the templates being built, from the
+// top-level file down to the template of this builder.
+func (b *Builder) includeChain() []string {
+	var chain []string
+	for builder := b; builder != nil; builder = builder.parent {
+		isIncluded := builder.tag != nil || builder.parent == nil
+		if isIncluded && builder.path != "" {
+			chain = append([]string{builder.path}, chain...)
+		}
+	}
+	return chain
+}
+
+// checkRecursion checks that the template of this builder is not already
+// being built by a parent builder, unless the template allows recursion
+// in which case it's checked against the maximum recursion depth.
+func (b *Builder) checkRecursion() error {
+	if b.tag == nil || b.parent == nil {
+		return nil
+	}
+
+	parentChain := b.parent.includeChain()
+	depth := 0
+	cycleStart := -1
+	for i, path := range parentChain {
+		if path == b.path {
+			depth++
+			if cycleStart < 0 {
+				cycleStart = i
+			}
+		}
+	}
+
+	if depth == 0 {
+		return nil
+	}
+
+	cycle := strings.Join(append(parentChain[cycleStart:], b.path), " -> ")
+	if !b.recursive {
+		return b.callerError("Circular template include %s", cycle)
+	}
+
+	maxDepth := b.Options.MaxRecursionDepth
+	if b.maxRecursionDepth > 0 && b.maxRecursionDepth < maxDepth {
+		maxDepth = b.maxRecursionDepth
+	}
+	if depth >= maxDepth {
+		return b.callerError("Exceeded the maximum recursion depth of %d for %s", maxDepth, cycle)
+	}
+
+	return nil
+}
+
+// setRecursive sets if this builder's template can be recursively included
+// from a "recursive" header value of "true" or a maximum depth.
+func (b *Builder) setRecursive(val []byte) error {
+	strVal := string(val)
+	if strVal == "true" || strVal == "" {
+		b.recursive = true
+		return nil
+	}
+	if strVal == "false" {
+		b.recursive = false
+		return nil
+	}
+
+	depth, err := strconv.Atoi(strVal)
+	if err != nil || depth < 1 {
+		return fmt.Errorf("Invalid recursive value \"%s\", Expected true, false or a maximum depth", strVal)
+	}
+	b.recursive = true
+	b.maxRecursionDepth = depth
+	return nil
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/ssddanbrown/haste/options"
+)
+
+var (
+	loopTagName = []byte("each")
+)
+
+func NewLoopTag(attrs map[string][]byte, opts *options.Options) *templateTag {
+	tag := &templateTag{
+		name:    loopTagName,
+		attrs:   attrs,
+		tagType: "loop",
+		options: opts,
+	}
+	return tag
+}
+
+// loopItemVars provides a set of scoped vars for each item of the list
+// this loop tag iterates over.
+func (t *templateTag) loopItemVars(vars map[string][]byte) []map[string][]byte {
+	itemName := t.attrOrDefault("as", "item")
+	indexName := t.attrOrDefault("index", "index")
+
+	items := listItems(vars, string(t.attrs["items"]), itemName)
+	for i, itemVars := range items {
+		itemVars[indexName] = []byte(strconv.Itoa(i))
+	}
+	return items
+}
+
+func (t *templateTag) attrOrDefault(name string, defaultVal string) string {
+	val, ok := t.attrs[name]
+	if !ok || len(val) == 0 {
+		return defaultVal
+	}
+	return string(val)
+}
+
+// listItems finds the items of the list variable with the given name,
+// providing the vars of each item under the given item name.
+// Lists are either indexed variables (name.0, name.1, ...), where
+// items may have their own fields (name.0.title), or a comma-separated value.
+func listItems(vars map[string][]byte, name string, itemName string) []map[string][]byte {
+	var items []map[string][]byte
+
+	for i := 0; ; i++ {
+		itemKey := name + "." + strconv.Itoa(i)
+		val, ok := vars[itemKey]
+		if !ok {
+			break
+		}
+
+		itemVars := map[string][]byte{itemName: val}
+		fieldPrefix := itemKey + "."
+		for key, fieldVal := range vars {
+			if strings.HasPrefix(key, fieldPrefix) {
+				itemVars[itemName+"."+key[len(fieldPrefix):]] = fieldVal
+			}
+		}
+		items = append(items, itemVars)
+	}
+
+	if len(items) > 0 {
+		return items
+	}
+
+	for _, val := range bytes.Split(vars[name], []byte{','}) {
+		val = bytes.TrimSpace(val)
+		if len(val) > 0 {
+			items = append(items, map[string][]byte{itemName: val})
+		}
+	}
+	return items
+}
@@ -1,24 +1,41 @@
 package engine
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/fatih/color"
 	"github.com/ssddanbrown/haste/options"
 )
 
 // A Manager keeps control over builds and keeps track of what files are in build
 // in addition to containing build-based configuration such as syntax patterns.
+// A Manager is safe for concurrent use, with builds being run one at a time.
 type Manager struct {
 	options *options.Options
 
+	// Held while building or accessing build files
+	mutex sync.Mutex
+
 	buildFiles map[string]*BuildFile
-	glob       string
+	globs      []string
 	globDepth  int
+
+	// Output locations of the last written version of each asset
+	assetOutPaths map[string]string
+	assetLock     sync.Mutex
+
+	// Paths of the files used by build files as of the last build, which
+	// can be checked without waiting for any in-progress build
+	dependencies   map[string]bool
+	dependencyLock sync.RWMutex
 }
 
 // NewManager creates and initializes a new Manager with a set of defaults
@@ -26,8 +43,16 @@ func NewManager(options *options.Options) *Manager {
 	m := &Manager{
 		options:    options,
 		buildFiles: make(map[string]*BuildFile),
-		glob:       "*" + options.BuildFileExtension,
-		globDepth:  5,
+		globs: []string{
+			"*" + options.BuildFileExtension,
+			"*" + options.MarkdownBuildFileExtension,
+		},
+		globDepth:     5,
+		assetOutPaths: make(map[string]string),
+	}
+
+	if len(options.InputGlobs) > 0 {
+		m.globs = options.InputGlobs
 	}
 
 	if options.InputPaths != nil {
@@ -71,30 +96,171 @@ func (m *Manager) loadPath(path string) error {
 	return err
 }
 
-func (m *Manager) BuildAll() []string {
+// BuildAll builds all build files, providing the paths of the files output.
+// Returns an error if any of the build files failed to build.
+func (m *Manager) BuildAll() ([]string, error) {
+	return m.BuildAllContext(context.Background())
+}
 
+// BuildAllContext builds all build files, like BuildAll, stopping early
+// with the context's error if the given context is cancelled.
+func (m *Manager) BuildAllContext(ctx context.Context) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer m.updateDependencies()
+
+	outPaths, err := m.CopyPassthroughFiles()
+	if err != nil {
+		return outPaths, fmt.Errorf("Could not copy passthrough files: %s", err)
+	}
+
+	cache := m.loadBuildCache()
+	var buildFiles []*BuildFile
+	for _, bf := range m.buildFiles {
+		buildFiles = append(buildFiles, bf)
+	}
+
+	builtPaths, failed := m.buildConcurrently(ctx, buildFiles, cache)
+	outPaths = append(outPaths, builtPaths...)
+
+	if cache != nil {
+		err = m.saveBuildCache(cache)
+		if err != nil {
+			color.Red("Could not save build cache: %s", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return outPaths, ctx.Err()
+	}
+	return outPaths, buildFailure(failed, len(buildFiles))
+}
+
+// buildConcurrently builds the given BuildFiles using a pool of workers,
+// skipping files that are fresh in the given cache if provided. No more files
+// are built once the context is cancelled. Provides the paths of the files
+// output and the number of files that failed to build.
+func (m *Manager) buildConcurrently(ctx context.Context, buildFiles []*BuildFile, cache *buildCache) ([]string, int) {
 	var outPaths []string
+	var failed int
 	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	jobs := make(chan *BuildFile)
 
-	for _, bf := range m.buildFiles {
+	workers := m.options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(bf *BuildFile) {
+		go func() {
 			defer wg.Done()
-			outPath, err := m.BuildToFile(bf)
-			outPaths = append(outPaths, outPath)
-			if err != nil {
-				fmt.Println(err)
+			for bf := range jobs {
+				if ctx.Err() != nil || (cache != nil && m.isFresh(cache, bf)) {
+					continue
+				}
+
+				bfOutPaths, err := m.buildOutputs(ctx, bf)
+				if cache != nil {
+					m.updateBuildCache(cache, bf, bfOutPaths, err)
+				}
+
+				resultLock.Lock()
+				outPaths = append(outPaths, bfOutPaths...)
+				if err != nil && ctx.Err() == nil {
+					failed++
+					printBuildError(err)
+				}
+				resultLock.Unlock()
 			}
-		}(bf)
+		}()
 	}
 
+queueFiles:
+	for _, bf := range buildFiles {
+		select {
+		case jobs <- bf:
+		case <-ctx.Done():
+			break queueFiles
+		}
+	}
+
+	close(jobs)
 	wg.Wait()
-	return outPaths
+	return outPaths, failed
+}
+
+// printBuildError outputs the given error unless it's a BuildError,
+// which will have already been output as diagnostics.
+func printBuildError(err error) {
+	if _, isBuildError := err.(*BuildError); !isBuildError {
+		color.Red("%s", err)
+	}
+}
+
+func buildFailure(failed int, total int) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d build files failed to build", failed, total)
+}
+
+// buildOutputs builds the given BuildFile to its output file or, if it
+// declares a collection, builds an output file for each record until
+// the given context is cancelled.
+func (m *Manager) buildOutputs(ctx context.Context, bf *BuildFile) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	records, err := m.collectionRecords(bf)
+	if err != nil {
+		return nil, err
+	}
+
+	if records == nil {
+		outPath, err := m.BuildToFile(bf)
+		m.removeStaleOutputs(bf, []string{outPath})
+		bf.records = nil
+		bf.outputs = []string{outPath}
+		return bf.outputs, err
+	}
+
+	var outPaths []string
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return outPaths, ctx.Err()
+		}
+
+		outPath, recordErr := m.BuildToFile(record)
+		outPaths = append(outPaths, outPath)
+		if recordErr != nil {
+			err = recordErr
+		}
+
+		for include := range record.includes {
+			bf.includes[include] = true
+		}
+	}
+
+	m.removeStaleOutputs(bf, outPaths)
+	bf.records = records
+	bf.outputs = outPaths
+	return outPaths, err
 }
 
 func (m *Manager) BuildToFile(b *BuildFile) (string, error) {
 	relPath := b.path
-	outPath := strings.TrimSuffix(relPath, m.options.BuildFileExtension) + ".html"
+	outPath := strings.TrimSuffix(relPath, m.options.BuildFileExtension)
+	outPath = strings.TrimSuffix(outPath, m.options.MarkdownBuildFileExtension) + ".html"
+
+	// Build files found via custom input globs keep their name
+	if !strings.HasSuffix(relPath, m.options.BuildFileExtension) && !strings.HasSuffix(relPath, m.options.MarkdownBuildFileExtension) {
+		outPath = strings.TrimSuffix(relPath, filepath.Ext(relPath)) + ".html"
+	}
+	if b.outPath != "" {
+		outPath = b.outPath
+	}
 	outPath = filepath.Join(m.options.OutPath, outPath)
 	outPathDir := filepath.Dir(outPath)
 	err := os.MkdirAll(outPathDir, os.ModePerm)
@@ -103,52 +269,257 @@ func (m *Manager) BuildToFile(b *BuildFile) (string, error) {
 	}
 
 	reader, err := m.Build(b)
+	if err != nil {
+		return outPath, err
+	}
+
 	file, err := os.Create(outPath)
 	if err != nil {
 		return outPath, err
 	}
+	defer file.Close()
 
-	io.Copy(file, reader)
+	_, err = io.Copy(file, reader)
+	assetErr := m.writeAssets(b)
+	if err == nil {
+		err = assetErr
+	}
+	m.printDiagnostics(b)
 	return outPath, err
 }
 
-func (m *Manager) NotifyChange(file string) []string {
+// writeAssets copies the assets referenced by the given BuildFile to the output
+// folder, removing any previous version of each. Assets are added to the includes
+// of the BuildFile so it's rebuilt when an asset changes.
+func (m *Manager) writeAssets(b *BuildFile) error {
+	if b.assets == nil {
+		return nil
+	}
+
+	m.assetLock.Lock()
+	defer m.assetLock.Unlock()
+
+	for _, asset := range b.assets.Items() {
+		b.includes[asset.Path] = true
+		outPath := filepath.Join(m.options.OutPath, asset.OutPath)
+		if previous, ok := m.assetOutPaths[asset.Path]; ok && previous != outPath {
+			os.Remove(previous)
+		}
+		m.assetOutPaths[asset.Path] = outPath
+
+		if _, err := os.Stat(outPath); err == nil {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(outPath), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(outPath, asset.Content, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diagnostics provides the diagnostics found in the last build of all build files.
+func (m *Manager) Diagnostics() []*Diagnostic {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var diagnostics []*Diagnostic
+	for _, bf := range m.buildFiles {
+		diagnostics = append(diagnostics, bf.Diagnostics()...)
+	}
+	return diagnostics
+}
+
+// printDiagnostics outputs the diagnostics found when building the given BuildFile.
+func (m *Manager) printDiagnostics(bf *BuildFile) {
+	for _, d := range bf.Diagnostics() {
+		if d.Severity == SeverityWarning {
+			color.Yellow("%s", d.Format(m.options.TemplateResolver))
+		} else {
+			color.Red("%s", d.Format(m.options.TemplateResolver))
+		}
+	}
+}
+
+// NotifyChange rebuilds the given file, if a build file, or the build files
+// that depend on it. Passthrough files are copied to the output folder.
+// Returns an error if any of these failed to build.
+func (m *Manager) NotifyChange(file string) ([]string, error) {
+	return m.NotifyChangeContext(context.Background(), file)
+}
+
+// NotifyChangeContext handles a change to the given file, like NotifyChange,
+// stopping early with the context's error if the given context is cancelled.
+func (m *Manager) NotifyChangeContext(ctx context.Context, file string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer m.updateDependencies()
+
 	var outPaths []string
 
-	// If a BuildFile rebuild and exit
-	match, err := filepath.Match(m.glob, filepath.Base(file))
+	if m.IsPassthroughFile(file) {
+		copiedPaths, err := m.copyPassthroughFiles(file)
+		if err != nil {
+			return outPaths, fmt.Errorf("Could not copy passthrough file \"%s\": %s", file, err)
+		}
+		outPaths = append(outPaths, copiedPaths...)
+	}
 
-	if match && err == nil {
+	// If a BuildFile rebuild and exit
+	if m.isBuildFile(file) {
 		bf := m.addBuildFile(file)
-		outPath, err := m.BuildToFile(bf)
-		outPaths = append(outPaths, outPath)
+		outPaths, err := m.buildOutputs(ctx, bf)
+		if ctx.Err() != nil {
+			return outPaths, ctx.Err()
+		}
 		if err != nil {
-			fmt.Println(err)
+			printBuildError(err)
+			return outPaths, buildFailure(1, 1)
 		}
-		return outPaths
+		return outPaths, nil
 	}
 
 	// Rebuild any BuildFiles that depend on this file
+	dependentOutPaths, err := m.buildDependents(ctx, func(include string) bool {
+		return include == file
+	})
+	return append(outPaths, dependentOutPaths...), err
+}
+
+// NotifyRemove handles the removal, or renaming, of the given file or folder.
+// Build files within are no longer built and their output files are deleted,
+// as are the copies of passthrough files. Build files that depend on a removed
+// file are rebuilt. Returns an error if any of these failed to build.
+func (m *Manager) NotifyRemove(path string) ([]string, error) {
+	return m.NotifyRemoveContext(context.Background(), path)
+}
+
+// NotifyRemoveContext handles the removal of the given file or folder, like
+// NotifyRemove, stopping early with the context's error if the given context
+// is cancelled.
+func (m *Manager) NotifyRemoveContext(ctx context.Context, path string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer m.updateDependencies()
+
+	path = filepath.Clean(path)
+	if path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return nil, nil
+	}
+
+	for bfPath, bf := range m.buildFiles {
+		if isWithinPath(bfPath, path) {
+			m.removeOutputs(bf)
+			delete(m.buildFiles, bfPath)
+		}
+	}
+
+	if m.IsPassthroughFile(path) {
+		os.RemoveAll(filepath.Join(m.options.OutPath, path))
+	}
+
+	return m.buildDependents(ctx, func(include string) bool {
+		return isWithinPath(include, path)
+	})
+}
+
+// HasDependents checks if any build files used the file at the given
+// root relative path when last built.
+func (m *Manager) HasDependents(path string) bool {
+	m.dependencyLock.RLock()
+	defer m.dependencyLock.RUnlock()
+	return m.dependencies[filepath.Clean(path)]
+}
+
+// updateDependencies records the files used by all build files.
+func (m *Manager) updateDependencies() {
+	dependencies := make(map[string]bool)
 	for _, bf := range m.buildFiles {
+		for include := range bf.includes {
+			dependencies[include] = true
+		}
+	}
 
-		if _, ok := bf.includes[file]; ok {
-			outPath, err := m.BuildToFile(bf)
-			outPaths = append(outPaths, outPath)
-			if err != nil {
-				fmt.Println(err)
-			}
+	m.dependencyLock.Lock()
+	defer m.dependencyLock.Unlock()
+	m.dependencies = dependencies
+}
+
+// buildDependents rebuilds the BuildFiles that have an include matching
+// the given function. Returns an error if any of these failed to build.
+func (m *Manager) buildDependents(ctx context.Context, matchesInclude func(include string) bool) ([]string, error) {
+	var dependents []*BuildFile
+	for _, bf := range m.buildFiles {
+		if bf.dependsOn(matchesInclude) {
+			dependents = append(dependents, bf)
+		}
+	}
+
+	outPaths, failed := m.buildConcurrently(ctx, dependents, nil)
+	if ctx.Err() != nil {
+		return outPaths, ctx.Err()
+	}
+	return outPaths, buildFailure(failed, len(dependents))
+}
+
+// removeOutputs deletes the files output by the last build of the given BuildFile.
+func (m *Manager) removeOutputs(bf *BuildFile) {
+	for _, outPath := range bf.outputs {
+		err := os.Remove(outPath)
+		if err != nil && !os.IsNotExist(err) {
+			color.Red("Could not remove output file \"%s\": %s", outPath, err)
 		}
 	}
-	return outPaths
+	bf.outputs = nil
+}
+
+// removeStaleOutputs deletes the files output by the last build of the given
+// BuildFile that are not within the given new output paths.
+func (m *Manager) removeStaleOutputs(bf *BuildFile, outPaths []string) {
+	current := make(map[string]bool)
+	for _, outPath := range outPaths {
+		current[outPath] = true
+	}
+
+	for _, outPath := range bf.outputs {
+		if current[outPath] {
+			continue
+		}
+		err := os.Remove(outPath)
+		if err != nil && !os.IsNotExist(err) {
+			color.Red("Could not remove output file \"%s\": %s", outPath, err)
+		}
+	}
+}
+
+// isWithinPath checks if the given path is, or is within, the folder path.
+func isWithinPath(path string, folderPath string) bool {
+	return path == folderPath || strings.HasPrefix(path, folderPath+string(filepath.Separator))
 }
 
 func (m *Manager) Build(buildFile *BuildFile) (io.Reader, error) {
 	fmt.Println("Building:", buildFile.path)
 	fullPath := filepath.Join(m.options.RootPath, buildFile.path)
-	file, err := os.Open(fullPath)
-	builder := NewBuilder(file, m.options, nil)
-	bReader := builder.Build()
+	// Read the file upfront, rather than streaming, so it's not left open
+	content, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewBuilder(bytes.NewReader(content), m.options, nil)
+	builder.mergeVars(buildFile.vars)
+	builder.path = buildFile.path
+	if m.isMarkdownBuildFile(buildFile.path) {
+		builder.contentType = "md"
+	}
+	bReader, err := builder.Build()
 	buildFile.includes = builder.FilesParsed
+	buildFile.assets = builder.Assets
+	buildFile.diagnostics = builder.Diagnostics
 	return bReader, err
 }
 
@@ -165,11 +536,62 @@ func (m *Manager) addBuildFile(path string) *BuildFile {
 func (m *Manager) scanNewBuildFiles(root string) ([]string, error) {
 	var fileList []string
 	err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
-		match, err := filepath.Match(m.glob, f.Name())
-		if match && err == nil {
+		if err != nil {
+			return nil
+		}
+
+		relPath, relErr := filepath.Rel(m.options.RootPath, path)
+		if relErr == nil && relPath != "." && m.isExcluded(relPath) {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !f.IsDir() && m.isBuildFile(f.Name()) {
 			fileList = append(fileList, path)
 		}
 		return nil
 	})
 	return fileList, err
 }
+
+// isBuildFile checks if the given file name matches any of the build file globs
+func (m *Manager) isBuildFile(file string) bool {
+	if m.isExcluded(file) {
+		return false
+	}
+
+	for _, glob := range m.globs {
+		match, err := filepath.Match(glob, filepath.Base(file))
+		if match && err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) isMarkdownBuildFile(file string) bool {
+	return strings.HasSuffix(file, m.options.MarkdownBuildFileExtension)
+}
+
+// isExcluded checks if the given root relative path, or any of
+// its parent folders, match any of the exclude globs.
+func (m *Manager) isExcluded(path string) bool {
+	return matchesPathGlobs(path, m.options.ExcludeGlobs)
+}
+
+// matchesPathGlobs checks if the given root relative path, or any of
+// its parent folders, match any of the given globs.
+func matchesPathGlobs(path string, globs []string) bool {
+	for _, glob := range globs {
+		glob = filepath.FromSlash(glob)
+		for p := filepath.Clean(path); p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+			match, err := filepath.Match(glob, p)
+			if match && err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
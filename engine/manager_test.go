@@ -2,12 +2,16 @@ package engine
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"github.com/ssddanbrown/haste/loading"
 	"github.com/ssddanbrown/haste/options"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -158,7 +162,10 @@ func TestManager_BuildAll(t *testing.T) {
 `)
 
 	m := NewManager(o)
-	m.BuildAll()
+	_, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
 
 	outFiles := []string{"index.html", "about.html"}
 
@@ -200,7 +207,10 @@ func TestManager_NotifyChange(t *testing.T) {
 	}
 
 	writeTestFile(t, "include.html", "<p>hello</p>", o)
-	m.NotifyChange("include.html")
+	_, err = m.NotifyChange("include.html")
+	if err != nil {
+		t.Fatalf("Error while running change build: %s", err)
+	}
 
 	outputStr = readTestFile(t, "dist/index.html", o)
 	expectedContent = "<html><body><p>hello</p></body></html>"
@@ -208,3 +218,655 @@ func TestManager_NotifyChange(t *testing.T) {
 		t.Fatal(buildResultErrorMessage(expectedContent, outputStr))
 	}
 }
+
+func TestManager_NotifyChangeRebuildsOnDataFileChange(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "index.haste.html", "@data=team.json\n<p>{{team.lead}}</p>", o)
+	writeTestFile(t, "team.json", `{"lead": "Dan"}`, o)
+
+	m := NewManager(o)
+	_, err := m.BuildToFile(m.buildFiles["index.haste.html"])
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	writeTestFile(t, "team.json", `{"lead": "Sam"}`, o)
+	_, err = m.NotifyChange("team.json")
+	if err != nil {
+		t.Fatalf("Error while running change build: %s", err)
+	}
+
+	outputStr := readTestFile(t, "dist/index.html", o)
+	expectedContent := "<p>Sam</p>"
+	if outputStr != expectedContent {
+		t.Fatal(buildResultErrorMessage(expectedContent, outputStr))
+	}
+}
+
+func TestManager_BuildMarkdownPageWithLayout(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "post.haste.md", "---\nlayout: layout\ntitle: My Post\n---\n# {{title}}\n\nSome @{{text}}", o)
+	writeTestFile(t, "layout.html", "<html><title>{{title}}</title><body>{{content}}</body></html>", o)
+
+	m := NewManager(o)
+	if _, ok := m.buildFiles["post.haste.md"]; !ok {
+		t.Fatalf("Expected markdown build file to be found")
+	}
+
+	_, err := m.BuildToFile(m.buildFiles["post.haste.md"])
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	outputStr := readTestFile(t, "dist/post.html", o)
+	expectedContent := "<html><title>My Post</title><body><h1>My Post</h1>\n<p>Some {{text}}</p></body></html>"
+	if outputStr != expectedContent {
+		t.Fatal(buildResultErrorMessage(expectedContent, outputStr))
+	}
+
+	if _, ok := m.buildFiles["post.haste.md"].includes["layout.html"]; !ok {
+		t.Errorf("Expected layout to be tracked as an include of the markdown page")
+	}
+}
+
+func TestManager_BuildAllGeneratesCollectionPages(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "post.haste.html", "@collection=posts.json\n@output=posts/{{slug}}.html\n@site=Blog\n<h1>{{title}} - {{site}}</h1>", o)
+	writeTestFile(t, "posts.json", `[{"slug": "first", "title": "First"}, {"slug": "second", "title": "Second"}]`, o)
+
+	m := NewManager(o)
+	outPaths, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+	if len(outPaths) != 2 {
+		t.Fatalf("Expected 2 output files, Got %d", len(outPaths))
+	}
+
+	for slug, title := range map[string]string{"first": "First", "second": "Second"} {
+		outputStr := readTestFile(t, "dist/posts/"+slug+".html", o)
+		expectedContent := "<h1>" + title + " - Blog</h1>"
+		if outputStr != expectedContent {
+			t.Error(buildResultErrorMessage(expectedContent, outputStr))
+		}
+	}
+
+	if _, ok := m.buildFiles["post.haste.html"].includes["posts.json"]; !ok {
+		t.Errorf("Expected collection data file to be tracked as an include")
+	}
+
+	writeTestFile(t, "posts.json", `[{"slug": "first", "title": "Changed"}]`, o)
+	outPaths, err = m.NotifyChange("posts.json")
+	if err != nil {
+		t.Fatalf("Error while running change build: %s", err)
+	}
+	if len(outPaths) != 1 {
+		t.Fatalf("Expected 1 output file after change, Got %d", len(outPaths))
+	}
+
+	outputStr := readTestFile(t, "dist/posts/first.html", o)
+	if outputStr != "<h1>Changed - Blog</h1>" {
+		t.Error(buildResultErrorMessage("<h1>Changed - Blog</h1>", outputStr))
+	}
+
+	if _, err := os.Stat(filepath.Join(o.OutPath, "posts/second.html")); !os.IsNotExist(err) {
+		t.Errorf("Expected output of removed collection record to be deleted")
+	}
+}
+
+func TestManager_BuildAllWithEmptyCollectionOutputsNothing(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "post.haste.html", "@collection=posts.json\n@output=posts/{{slug}}.html\n<h1>{{title}}</h1>", o)
+	writeTestFile(t, "posts.json", `[]`, o)
+
+	m := NewManager(o)
+	outPaths, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+	if len(outPaths) != 0 {
+		t.Fatalf("Expected 0 output files, Got %d", len(outPaths))
+	}
+	if _, err := os.Stat(filepath.Join(o.OutPath, "post.html")); !os.IsNotExist(err) {
+		t.Errorf("Expected no page to be output for an empty collection")
+	}
+}
+
+func TestManager_BuildAllReportsInvalidCollectionOutputPaths(t *testing.T) {
+	cases := []struct {
+		data          string
+		expectedError string
+	}{
+		{`[{"slug": "a"}, {"slug": "a"}]`, "Multiple collection records resolve to the output path"},
+		{`[{"title": "No slug"}]`, "has an empty file name"},
+	}
+
+	for _, testCase := range cases {
+		cleanup, o := getTempDirOptions(t)
+		o.InputPaths = []string{o.RootPath}
+
+		writeTestFile(t, "post.haste.html", "@collection=posts.json\n@output=posts/{{slug}}.html\n<h1>{{title}}</h1>", o)
+		writeTestFile(t, "posts.json", testCase.data, o)
+
+		m := NewManager(o)
+		_, err := m.buildOutputs(context.Background(), m.buildFiles["post.haste.html"])
+		if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+			t.Errorf("Expected error containing \"%s\", Got: %v", testCase.expectedError, err)
+		}
+		cleanup()
+	}
+}
+
+func TestManager_DiagnosticsProvidesBuildErrors(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "index.haste.html", "<p>\n<t:missing/></p>", o)
+
+	m := NewManager(o)
+	_, err := m.BuildAll()
+	if err == nil {
+		t.Errorf("Expected BuildAll to return an error")
+	}
+
+	diagnostics := m.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, Got %d", len(diagnostics))
+	}
+
+	if diagnostics[0].Location() != "index.haste.html:2:1" {
+		t.Errorf("Expected diagnostic at index.haste.html:2:1, Found at %s", diagnostics[0].Location())
+	}
+}
+
+func TestManager_BuildAllFailsOnWarningsWhenTreatedAsErrors(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "index.haste.html", "<p>Hello</p>", o)
+	writeTestFile(t, "about.haste.html", "<p>About</p>", o)
+
+	m := NewManager(o)
+	m.BuildAll()
+	m.buildFiles["index.haste.html"].diagnostics.Add(&Diagnostic{Severity: SeverityWarning, Message: "Test warning"})
+
+	failing := failingDiagnostics(m.Diagnostics(), o.WarningsAsErrors)
+	if len(failing) != 0 {
+		t.Errorf("Expected warnings not to fail the build by default")
+	}
+
+	o.WarningsAsErrors = true
+	failing = failingDiagnostics(m.Diagnostics(), o.WarningsAsErrors)
+	if len(failing) != 1 {
+		t.Errorf("Expected warnings to fail the build when treated as errors")
+	}
+}
+
+func TestManager_UsesProjectConfigFile(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "haste.toml", `
+include = ["*.page.html"]
+exclude = ["drafts"]
+tagPrefix = "x:"
+varTagOpen = "[["
+varTagClose = "]]"
+
+[vars]
+site = "My Site"
+[vars.author]
+name = "Dan"
+
+[server]
+port = 9000
+`, o)
+	createTestDir(t, "drafts", o)
+	writeTestFile(t, "index.page.html", "@site=Overridden\n<x:header/>[[site]]", o)
+	writeTestFile(t, "header.html", "<h1>[[site]] by [[author.name]]</h1>", o)
+	writeTestFile(t, "drafts/draft.page.html", "<p>Draft</p>", o)
+	writeTestFile(t, "other.haste.html", "<p>Other</p>", o)
+
+	configPath, err := o.LoadConfigFile(o.RootPath)
+	if err != nil {
+		t.Fatalf("Error while loading config file: %s", err)
+	}
+	if configPath != filepath.Join(o.RootPath, "haste.toml") {
+		t.Errorf("Expected haste.toml to be loaded, Loaded %s", configPath)
+	}
+	if o.ServerPort != 9000 || o.LiveReload != true {
+		t.Errorf("Expected server options to be set from config, Port: %d, LiveReload: %t", o.ServerPort, o.LiveReload)
+	}
+
+	m := NewManager(o)
+	if len(m.buildFiles) != 1 {
+		t.Fatalf("Expected only index.page.html to be found as a build file, Found %d build files", len(m.buildFiles))
+	}
+
+	_, err = m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	outputStr := readTestFile(t, "dist/index.page.html", o)
+	expectedContent := "<h1>Overridden by Dan</h1>Overridden"
+	if outputStr != expectedContent {
+		t.Error(buildResultErrorMessage(expectedContent, outputStr))
+	}
+}
+
+func TestManager_UsesConfigFileProfile(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "haste.json", `{
+	"vars": {"env": "dev", "name": "Site", "site": {"url": "localhost", "lang": "en"}},
+	"profiles": {
+		"production": {
+			"vars": {"env": "prod", "site": {"url": "example.com"}},
+			"minify": {"html": true}
+		}
+	}
+}`, o)
+	writeTestFile(t, "index.haste.html", "<div>\n    <p>{{env}} {{name}} {{site.url}} {{site.lang}}</p>\n</div>", o)
+
+	o.Profile = "production"
+	_, err := o.LoadConfigFile(o.RootPath)
+	if err != nil {
+		t.Fatalf("Error while loading config file: %s", err)
+	}
+	if !o.MinifyHTML || o.MinifyCSS {
+		t.Errorf("Expected only HTML minification to be enabled by profile, HTML: %t, CSS: %t", o.MinifyHTML, o.MinifyCSS)
+	}
+
+	m := NewManager(o)
+	_, err = m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	outputStr := readTestFile(t, "dist/index.html", o)
+	expectedContent := "<div><p>prod Site example.com en</p></div>"
+	if outputStr != expectedContent {
+		t.Error(buildResultErrorMessage(expectedContent, outputStr))
+	}
+
+	o.Profile = "staging"
+	_, err = o.LoadConfigFile(o.RootPath)
+	if err == nil || !strings.Contains(err.Error(), "Could not find profile \"staging\"") {
+		t.Errorf("Expected error for unknown profile, Got: %v", err)
+	}
+}
+
+func TestManager_BuildAllCopiesHashedAssets(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	createTestDir(t, "css", o)
+	writeTestFile(t, "css/styles.css", "body { color: red; }", o)
+	writeTestFile(t, "index.haste.html", `<link href="{{asset "css/styles.css"}}">`, o)
+	m := NewManager(o)
+
+	_, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	expectedContent := `<link href="/css/styles.5de625c3.css">`
+	outputStr := readTestFile(t, "dist/index.html", o)
+	if outputStr != expectedContent {
+		t.Error(buildResultErrorMessage(expectedContent, outputStr))
+	}
+	if assetContent := readTestFile(t, "dist/css/styles.5de625c3.css", o); assetContent != "body { color: red; }" {
+		t.Errorf("Expected asset to be copied to output folder, Got: %s", assetContent)
+	}
+
+	writeTestFile(t, "css/styles.css", "body { color: blue; }", o)
+	outPaths, err := m.NotifyChange(filepath.FromSlash("css/styles.css"))
+	if err != nil || len(outPaths) != 1 {
+		t.Fatalf("Expected page referencing asset to be rebuilt, Built: %v, Error: %v", outPaths, err)
+	}
+
+	outputStr = readTestFile(t, "dist/index.html", o)
+	if outputStr == expectedContent {
+		t.Errorf("Expected asset URL to change when asset content changes")
+	}
+	if _, err := os.Stat(filepath.Join(o.RootPath, "dist/css/styles.5de625c3.css")); !os.IsNotExist(err) {
+		t.Errorf("Expected previous version of asset to be removed")
+	}
+}
+
+func TestManager_HasDependents(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	createTestDir(t, "images", o)
+	writeTestFile(t, "images/photo.png", "PNG", o)
+	writeTestFile(t, "images/logo.svg", "<svg></svg>", o)
+	writeTestFile(t, "images/unused.png", "PNG", o)
+	writeTestFile(t, "index.haste.html", `<img src="{{asset 'images/photo.png'}}"><t:images.logo.svg/>`, o)
+	m := NewManager(o)
+
+	if m.HasDependents(filepath.FromSlash("images/photo.png")) {
+		t.Errorf("Expected no dependents before building")
+	}
+
+	_, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	for path, expected := range map[string]bool{"images/photo.png": true, "images/logo.svg": true, "images/unused.png": false} {
+		if m.HasDependents(filepath.FromSlash(path)) != expected {
+			t.Errorf("Expected HasDependents of \"%s\" to be %t", path, expected)
+		}
+	}
+}
+
+func TestManager_CachedPagesRemovePreviousAssetVersions(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "styles.css", "body { color: red; }", o)
+	writeTestFile(t, "index.haste.html", `<link href="{{asset "styles.css"}}">`, o)
+
+	_, err := NewManager(o).BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	m := NewManager(o)
+	outPaths, err := m.BuildAll()
+	if err != nil || len(outPaths) != 0 {
+		t.Fatalf("Expected page to be skipped via the build cache, Built: %v, Error: %v", outPaths, err)
+	}
+
+	writeTestFile(t, "styles.css", "body { color: blue; }", o)
+	_, err = m.NotifyChange("styles.css")
+	if err != nil {
+		t.Fatalf("Error while running change build: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(o.OutPath, "styles.5de625c3.css")); !os.IsNotExist(err) {
+		t.Errorf("Expected previous version of asset to be removed")
+	}
+}
+
+func TestManager_BuildAllCopiesPassthroughFiles(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	o.PassthroughGlobs = []string{"images", "*.txt"}
+	o.ExcludeGlobs = []string{"images/drafts"}
+	defer cleanup()
+
+	createTestDir(t, "images", o)
+	createTestDir(t, "images/drafts", o)
+	writeTestFile(t, "images/logo.png", "PNG", o)
+	writeTestFile(t, "images/drafts/draft.png", "Draft", o)
+	writeTestFile(t, "robots.txt", "User-agent: *", o)
+	writeTestFile(t, "notes.md", "Notes", o)
+	writeTestFile(t, "index.haste.html", "<p>Home</p>", o)
+	m := NewManager(o)
+
+	outPaths, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+	if len(outPaths) != 3 {
+		t.Errorf("Expected two passthrough files and one build file to be output, Got: %v", outPaths)
+	}
+
+	if content := readTestFile(t, "dist/images/logo.png", o); content != "PNG" {
+		t.Errorf("Expected passthrough file to be copied, Got: %s", content)
+	}
+	if content := readTestFile(t, "dist/robots.txt", o); content != "User-agent: *" {
+		t.Errorf("Expected passthrough file to be copied, Got: %s", content)
+	}
+	for _, name := range []string{"dist/images/drafts/draft.png", "dist/notes.md", "dist/dist"} {
+		if _, err := os.Stat(filepath.Join(o.RootPath, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to not be output", name)
+		}
+	}
+
+	outPaths, err = m.BuildAll()
+	if err != nil || len(outPaths) != 0 {
+		t.Errorf("Expected unchanged files to not be output again, Got: %v", outPaths)
+	}
+
+	writeTestFile(t, "images/logo.png", "New PNG", o)
+	outPaths, err = m.NotifyChange(filepath.FromSlash("images/logo.png"))
+	if err != nil || len(outPaths) != 1 {
+		t.Errorf("Expected changed passthrough file to be copied, Got: %v, Error: %v", outPaths, err)
+	}
+	if content := readTestFile(t, "dist/images/logo.png", o); content != "New PNG" {
+		t.Errorf("Expected passthrough file to be updated, Got: %s", content)
+	}
+	createTestDir(t, "images/icons", o)
+	writeTestFile(t, "images/icons/star.png", "Star", o)
+	outPaths, err = m.NotifyChange(filepath.FromSlash("images/icons"))
+	if err != nil || len(outPaths) != 1 {
+		t.Errorf("Expected files within new passthrough folder to be copied, Got: %v, Error: %v", outPaths, err)
+	}
+	if content := readTestFile(t, "dist/images/icons/star.png", o); content != "Star" {
+		t.Errorf("Expected passthrough folder file to be copied, Got: %s", content)
+	}
+
+	if m.IsPassthroughFile(filepath.FromSlash("dist/robots.txt")) {
+		t.Errorf("Expected files within the output folder to not be passed through")
+	}
+}
+
+func TestManager_BuildAllUsesBuildCache(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	o.UndefinedVariables = options.UndefinedVariablesWarn
+	defer cleanup()
+
+	writeTestFile(t, "header.html", "<h1>Header</h1>", o)
+	writeTestFile(t, "card.html", "<t:header/><p>Card</p>", o)
+	writeTestFile(t, "index.haste.html", "<t:card/>", o)
+	writeTestFile(t, "about.haste.html", "<p>About</p>", o)
+	writeTestFile(t, "warning.haste.html", "<p>{{missing}}</p>", o)
+
+	buildAll := func() []string {
+		outPaths, err := NewManager(o).BuildAll()
+		if err != nil {
+			t.Fatalf("Error while running build: %s", err)
+		}
+		for i, outPath := range outPaths {
+			outPaths[i], _ = filepath.Rel(o.OutPath, outPath)
+		}
+		sort.Strings(outPaths)
+		return outPaths
+	}
+
+	if outPaths := buildAll(); len(outPaths) != 3 {
+		t.Fatalf("Expected all files to be built on first build, Got: %v", outPaths)
+	}
+
+	if _, err := os.Stat(filepath.Join(o.OutPath, buildCacheFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the build cache not to be saved within the output folder")
+	}
+	if _, err := os.Stat(filepath.Join(o.RootPath, buildCacheFileName)); err != nil {
+		t.Errorf("Expected the build cache to be saved within the root folder, Got: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		change   func()
+		expected string
+	}{
+		{"Unchanged", func() {}, "warning.html"},
+		{"Include changed", func() { writeTestFile(t, "header.html", "<h1>New Header</h1>", o) }, "index.html warning.html"},
+		{"Output changed", func() { writeTestFile(t, "dist/about.html", "Modified", o) }, "about.html warning.html"},
+		{"Output removed", func() { os.Remove(filepath.Join(o.OutPath, "index.html")) }, "index.html warning.html"},
+		{"Options changed", func() { o.AutoEscape = true }, "about.html index.html warning.html"},
+	}
+
+	for _, test := range tests {
+		test.change()
+		if outPaths := strings.Join(buildAll(), " "); outPaths != test.expected {
+			t.Errorf("%s: Expected %s to be built, Built: %s", test.name, test.expected, outPaths)
+		}
+	}
+
+	if outputStr := readTestFile(t, "dist/index.html", o); outputStr != "<h1>New Header</h1><p>Card</p>" {
+		t.Errorf("Expected page to be rebuilt with changed include, Got: %s", outputStr)
+	}
+
+	o.BuildCache = false
+	if outPaths := buildAll(); len(outPaths) != 3 {
+		t.Errorf("Expected all files to be built with build cache disabled, Got: %v", outPaths)
+	}
+}
+
+func TestManager_NotifyRemove(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	o.PassthroughGlobs = []string{"images"}
+	defer cleanup()
+
+	createTestDir(t, "images", o)
+	createTestDir(t, "blog", o)
+	writeTestFile(t, "images/logo.png", "PNG", o)
+	writeTestFile(t, "card.html", "<p>Card</p>", o)
+	writeTestFile(t, "index.haste.html", "<t:card/>", o)
+	writeTestFile(t, "about.haste.html", "<p>About</p>", o)
+	writeTestFile(t, "blog/post.haste.html", "<p>Post</p>", o)
+	NewManager(o).BuildAll()
+
+	// Use a new manager so outputs of unchanged pages are restored from the build cache
+	m := NewManager(o)
+	_, err := m.BuildAll()
+	if err != nil {
+		t.Fatalf("Error while running build: %s", err)
+	}
+
+	outputExists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(o.OutPath, name))
+		return !os.IsNotExist(err)
+	}
+
+	// Removed build file
+	os.Remove(filepath.Join(o.RootPath, "about.haste.html"))
+	outPaths, err := m.NotifyRemove("about.haste.html")
+	if err != nil || len(outPaths) != 0 {
+		t.Errorf("Expected nothing to be built on build file removal, Built: %v, Error: %v", outPaths, err)
+	}
+	if _, ok := m.buildFiles["about.haste.html"]; ok || outputExists("about.html") {
+		t.Errorf("Expected removed build file and its output to be removed")
+	}
+
+	// Renamed build file
+	os.Rename(filepath.Join(o.RootPath, "blog/post.haste.html"), filepath.Join(o.RootPath, "blog/news.haste.html"))
+	m.NotifyRemove(filepath.FromSlash("blog/post.haste.html"))
+	m.NotifyChange(filepath.FromSlash("blog/news.haste.html"))
+	if outputExists("blog/post.html") || !outputExists("blog/news.html") {
+		t.Errorf("Expected output of renamed build file to be moved")
+	}
+
+	// Removed folder and passthrough files
+	os.RemoveAll(filepath.Join(o.RootPath, "blog"))
+	os.RemoveAll(filepath.Join(o.RootPath, "images"))
+	m.NotifyRemove("blog")
+	m.NotifyRemove("images")
+	if len(m.buildFiles) != 1 || outputExists("blog/news.html") || outputExists("images/logo.png") {
+		t.Errorf("Expected build files and passthrough files within removed folders to be removed")
+	}
+
+	// Removed include
+	os.Remove(filepath.Join(o.RootPath, "card.html"))
+	outPaths, err = m.NotifyRemove("card.html")
+	if len(outPaths) != 1 || err == nil {
+		t.Errorf("Expected dependent page to be rebuilt and fail, Built: %v, Error: %v", outPaths, err)
+	}
+	diagnostics := m.Diagnostics()
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "Could not find tag with name \"card\"") {
+		t.Errorf("Expected missing include to be reported, Got: %v", diagnostics)
+	}
+}
+
+func TestManager_BuildAllContextCancelled(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	defer cleanup()
+
+	writeTestFile(t, "index.haste.html", "<p>Home</p>", o)
+	writeTestFile(t, "about.haste.html", "<p>About</p>", o)
+	m := NewManager(o)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outPaths, err := m.BuildAllContext(ctx)
+	if err != context.Canceled || len(outPaths) != 0 {
+		t.Errorf("Expected cancelled build to not build files, Built: %v, Error: %v", outPaths, err)
+	}
+
+	outPaths, err = m.NotifyChangeContext(ctx, "index.haste.html")
+	if err != context.Canceled || len(outPaths) != 0 {
+		t.Errorf("Expected cancelled rebuild to not build files, Built: %v, Error: %v", outPaths, err)
+	}
+
+	outPaths, err = m.BuildAll()
+	if err != nil || len(outPaths) != 2 {
+		t.Errorf("Expected files to be built after cancelled build, Built: %v, Error: %v", outPaths, err)
+	}
+}
+
+func TestManager_ConcurrentUse(t *testing.T) {
+	cleanup, o := getTempDirOptions(t)
+	o.InputPaths = []string{o.RootPath}
+	o.BuildCache = false
+	defer cleanup()
+
+	writeTestFile(t, "header.html", "<h1>Header</h1>", o)
+	for i := 0; i < 10; i++ {
+		writeTestFile(t, fmt.Sprintf("page-%d.haste.html", i), "<t:header/>", o)
+	}
+
+	for _, workers := range []int{1, 3} {
+		o.Workers = workers
+		m := NewManager(o)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				if outPaths, err := m.BuildAll(); err != nil || len(outPaths) != 10 {
+					t.Errorf("Expected all files to be built, Built: %d, Error: %v", len(outPaths), err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if outPaths, err := m.NotifyChange("header.html"); err != nil || len(outPaths) > 10 {
+					t.Errorf("Expected dependent files to be built, Built: %d, Error: %v", len(outPaths), err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				m.Diagnostics()
+			}()
+		}
+		wg.Wait()
+	}
+}
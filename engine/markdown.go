@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// CommonMark with tables, Raw HTML is allowed
+// so that the output of template tags is kept.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Table),
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+// renderMarkdown renders the markdown content of the given reader as HTML.
+// Errors found when rendering are passed to the given report function.
+func renderMarkdown(r io.Reader, report func(error)) io.Reader {
+	returnReader, w := io.Pipe()
+
+	go func() {
+		defer w.Close()
+
+		source, err := ioutil.ReadAll(r)
+		if err != nil {
+			w.CloseWithError(err)
+			return
+		}
+
+		var output bytes.Buffer
+		err = markdown.Convert(source, &output)
+		if err != nil {
+			report(fmt.Errorf("Could not render markdown: %s", err))
+		}
+		w.Write(bytes.TrimSpace(output.Bytes()))
+	}()
+
+	return returnReader
+}
@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Tags around which whitespace does not affect how content is displayed.
+// Whitespace is kept around all other tags, such as inline or custom elements.
+var blockTags = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true, "link": true,
+	"base": true, "script": true, "style": true, "noscript": true, "template": true,
+	"div": true, "p": true, "ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"table": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+	"caption": true, "colgroup": true, "col": true, "section": true, "article": true,
+	"header": true, "footer": true, "nav": true, "main": true, "aside": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "br": true,
+	"form": true, "fieldset": true, "legend": true, "figure": true, "figcaption": true,
+	"blockquote": true, "pre": true, "address": true, "details": true, "summary": true,
+	"option": true, "optgroup": true,
+}
+
+// Tags whose content is kept exactly as written
+var preformattedTags = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+}
+
+// Script types that contain JavaScript
+var javascriptTypes = map[string]bool{
+	"":                       true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"module":                 true,
+}
+
+// minifyHTMLReader minifies the HTML content of the given reader.
+func (b *Builder) minifyHTMLReader(r io.Reader) io.Reader {
+	returnReader, w := io.Pipe()
+
+	go func() {
+		source, err := ioutil.ReadAll(r)
+		if err == nil {
+			_, err = w.Write(minifyHTML(source, b.Options.MinifyCSS, b.Options.MinifyJS))
+		}
+		w.CloseWithError(err)
+	}()
+
+	return returnReader
+}
+
+// minifyHTML removes comments and collapses insignificant whitespace in the
+// given HTML. The content of style and script tags can optionally be minified.
+func minifyHTML(source []byte, minifyStyles bool, minifyScripts bool) []byte {
+	var out bytes.Buffer
+	tok := html.NewTokenizer(bytes.NewReader(source))
+
+	afterBlock := true
+	pendingSpace := false
+	preformattedDepth := 0
+	rawTag := ""
+	isScriptJS := false
+
+	for {
+		tt := tok.Next()
+		if tt == html.ErrorToken {
+			return out.Bytes()
+		}
+
+		// Copy the raw token since reading the tag name lower-cases it
+		raw := append([]byte(nil), tok.Raw()...)
+
+		switch tt {
+		case html.TextToken:
+			if rawTag == "style" && minifyStyles {
+				out.Write(minifyCSS(raw))
+			} else if rawTag == "script" && minifyScripts && isScriptJS {
+				out.Write(minifyJS(raw))
+			} else if rawTag != "" || preformattedDepth > 0 {
+				out.Write(raw)
+			} else {
+				text := collapseWhitespace(raw)
+				if afterBlock {
+					text = bytes.TrimLeft(text, " ")
+				}
+				if pendingSpace && len(text) > 0 && text[0] != ' ' {
+					out.WriteByte(' ')
+				}
+				pendingSpace = false
+				if len(text) == 0 {
+					continue
+				}
+				if text[len(text)-1] == ' ' {
+					text = text[:len(text)-1]
+					pendingSpace = true
+				}
+				out.Write(text)
+				if len(text) > 0 {
+					afterBlock = false
+				}
+			}
+		case html.CommentToken:
+			if bytes.HasPrefix(raw, []byte("<!--[if")) {
+				out.Write(raw)
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tok.TagName()
+			tagName := string(name)
+			isBlock := blockTags[tagName]
+
+			if pendingSpace && !isBlock {
+				out.WriteByte(' ')
+			}
+			pendingSpace = false
+			out.Write(raw)
+			afterBlock = isBlock
+
+			if preformattedTags[tagName] && tt == html.StartTagToken {
+				preformattedDepth++
+			} else if preformattedTags[tagName] && tt == html.EndTagToken && preformattedDepth > 0 {
+				preformattedDepth--
+			}
+
+			rawTag = ""
+			if (tagName == "script" || tagName == "style") && tt == html.StartTagToken {
+				rawTag = tagName
+				isScriptJS = javascriptTypes[strings.ToLower(string(tagAttr(tok, hasAttr, "type")))]
+			}
+		default:
+			pendingSpace = false
+			out.Write(raw)
+			afterBlock = true
+		}
+	}
+}
+
+// tagAttr provides the value of the named attribute of the current tag.
+func tagAttr(tok *html.Tokenizer, hasAttr bool, name string) []byte {
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = tok.TagAttr()
+		if string(key) == name {
+			return bytes.TrimSpace(val)
+		}
+	}
+	return nil
+}
+
+// collapseWhitespace replaces each run of whitespace with a single space.
+func collapseWhitespace(text []byte) []byte {
+	var out []byte
+	inSpace := false
+	for _, c := range text {
+		if isWhitespace(c) {
+			if !inSpace {
+				out = append(out, ' ')
+			}
+			inSpace = true
+			continue
+		}
+		inSpace = false
+		out = append(out, c)
+	}
+	return out
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f'
+}
+
+// minifyCSS removes comments and whitespace that's not needed from the given CSS.
+func minifyCSS(source []byte) []byte {
+	var out []byte
+	var quote byte
+	pendingSpace := false
+
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+
+		if quote != 0 {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(source) {
+				i++
+				out = append(out, source[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if c == '/' && i+1 < len(source) && source[i+1] == '*' {
+			commentEnd := bytes.Index(source[i+2:], []byte("*/"))
+			if commentEnd < 0 {
+				break
+			}
+			i += commentEnd + 3
+			pendingSpace = true
+			continue
+		}
+
+		if isWhitespace(c) {
+			pendingSpace = true
+			continue
+		}
+
+		if pendingSpace && len(out) > 0 && !strings.ContainsRune("{};:,>", rune(out[len(out)-1])) && !strings.ContainsRune("{};,>", rune(c)) {
+			out = append(out, ' ')
+		}
+		pendingSpace = false
+
+		// Remove the semicolon of the last declaration in a block
+		if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+			out = out[:len(out)-1]
+		}
+
+		if c == '"' || c == '\'' {
+			quote = c
+		}
+		out = append(out, c)
+	}
+
+	return bytes.TrimSpace(out)
+}
+
+// minifyJS removes comments and whitespace that's not needed from the given JavaScript.
+// Line breaks are kept where they may be needed for automatic semicolon insertion.
+func minifyJS(source []byte) []byte {
+	var out []byte
+	pendingSpace := false
+	pendingNewline := false
+
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+
+		// Comments
+		if c == '/' && i+1 < len(source) && source[i+1] == '/' {
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+			pendingNewline = true
+			continue
+		}
+		if c == '/' && i+1 < len(source) && source[i+1] == '*' {
+			commentEnd := bytes.Index(source[i+2:], []byte("*/"))
+			if commentEnd < 0 {
+				break
+			}
+			pendingNewline = pendingNewline || bytes.ContainsRune(source[i+2:i+2+commentEnd], '\n')
+			pendingSpace = true
+			i += commentEnd + 3
+			continue
+		}
+
+		if isWhitespace(c) {
+			pendingSpace = true
+			pendingNewline = pendingNewline || c == '\n'
+			continue
+		}
+
+		if len(out) > 0 && (pendingSpace || pendingNewline) {
+			prev := out[len(out)-1]
+			if pendingNewline && !strings.ContainsRune("{;,([", rune(prev)) && !strings.ContainsRune("})];,", rune(c)) {
+				out = append(out, '\n')
+			} else if isJSIdentifierChar(prev) && isJSIdentifierChar(c) || (prev == c && strings.ContainsRune("+-/", rune(c))) {
+				out = append(out, ' ')
+			}
+		}
+		pendingSpace = false
+		pendingNewline = false
+
+		// Strings and template literals
+		if c == '"' || c == '\'' || c == '`' {
+			end := jsLiteralEnd(source, i, c)
+			out = append(out, source[i:end]...)
+			i = end - 1
+			continue
+		}
+
+		// Regular expressions
+		if c == '/' && jsRegexAllowed(out) {
+			end := jsRegexEnd(source, i)
+			out = append(out, source[i:end]...)
+			i = end - 1
+			continue
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
+
+func isJSIdentifierChar(c byte) bool {
+	return isASCIILetter(c) || (c >= '0' && c <= '9') || c == '_' || c == '$' || c == '\\' || c > 127
+}
+
+// jsLiteralEnd provides the index after the end of the string or
+// template literal, started by the given quote, at the start index.
+func jsLiteralEnd(source []byte, start int, quote byte) int {
+	for i := start + 1; i < len(source); i++ {
+		if source[i] == '\\' {
+			i++
+		} else if source[i] == quote {
+			return i + 1
+		}
+	}
+	return len(source)
+}
+
+// jsRegexAllowed checks if a "/" following the given output starts a regular expression.
+func jsRegexAllowed(out []byte) bool {
+	trimmed := bytes.TrimRight(out, " \n")
+	if len(trimmed) == 0 {
+		return true
+	}
+
+	if strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(trimmed[len(trimmed)-1])) {
+		return true
+	}
+
+	for _, keyword := range []string{"return", "typeof", "case", "do", "else", "in", "of", "void", "yield"} {
+		if bytes.HasSuffix(trimmed, []byte(keyword)) {
+			before := len(trimmed) - len(keyword) - 1
+			if before < 0 || !isJSIdentifierChar(trimmed[before]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsRegexEnd provides the index after the end of the regular expression,
+// including any flags, at the start index.
+func jsRegexEnd(source []byte, start int) int {
+	inClass := false
+	for i := start + 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return i
+		case '/':
+			if !inClass {
+				i++
+				for i < len(source) && isJSIdentifierChar(source[i]) {
+					i++
+				}
+				return i
+			}
+		}
+	}
+	return len(source)
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CopyPassthroughFiles copies all files matching the passthrough globs
+// to the same location within the output folder, skipping files that are
+// unchanged since last copied. Provides the paths of the files copied.
+func (m *Manager) CopyPassthroughFiles() ([]string, error) {
+	return m.copyPassthroughFiles(".")
+}
+
+// copyPassthroughFiles copies the files matching the passthrough globs
+// at, or within, the given root relative path to the output folder.
+// Provides the paths of the files copied.
+func (m *Manager) copyPassthroughFiles(relRoot string) ([]string, error) {
+	var outPaths []string
+	if len(m.options.PassthroughGlobs) == 0 {
+		return outPaths, nil
+	}
+
+	root := filepath.Join(m.options.RootPath, relRoot)
+	err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(m.options.RootPath, path)
+		if err != nil || relPath == "." {
+			return nil
+		}
+
+		if f.IsDir() {
+			if path == m.options.OutPath || m.isExcluded(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !m.IsPassthroughFile(relPath) {
+			return nil
+		}
+
+		outPath, copied, err := m.copyPassthroughFile(relPath)
+		if copied {
+			outPaths = append(outPaths, outPath)
+		}
+		return err
+	})
+
+	return outPaths, err
+}
+
+// IsPassthroughFile checks if the given root relative path, or any of its
+// parent folders, match any of the passthrough globs. Files within the
+// output folder, and the build cache, are never passed through.
+func (m *Manager) IsPassthroughFile(path string) bool {
+	outRelPath, err := filepath.Rel(m.options.OutPath, filepath.Join(m.options.RootPath, path))
+	if err == nil && outRelPath != ".." && !strings.HasPrefix(outRelPath, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if path == buildCacheFileName {
+		return false
+	}
+	return !m.isExcluded(path) && matchesPathGlobs(path, m.options.PassthroughGlobs)
+}
+
+// copyPassthroughFile copies the file at the given root relative path to
+// the output folder unless a copy of the same size and modification time exists.
+func (m *Manager) copyPassthroughFile(relPath string) (outPath string, copied bool, err error) {
+	srcPath := filepath.Join(m.options.RootPath, relPath)
+	outPath = filepath.Join(m.options.OutPath, relPath)
+
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil || srcInfo.IsDir() {
+		return outPath, false, err
+	}
+	if outInfo, err := os.Stat(outPath); err == nil && outInfo.Size() == srcInfo.Size() && outInfo.ModTime().Equal(srcInfo.ModTime()) {
+		return outPath, false, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(outPath), os.ModePerm)
+	if err != nil {
+		return outPath, false, err
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return outPath, false, err
+	}
+	defer src.Close()
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return outPath, false, err
+	}
+
+	_, err = io.Copy(out, src)
+	out.Close()
+	if err != nil {
+		return outPath, false, err
+	}
+
+	return outPath, true, os.Chtimes(outPath, srcInfo.ModTime(), srcInfo.ModTime())
+}
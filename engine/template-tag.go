@@ -1,7 +1,6 @@
 package engine
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
@@ -9,8 +8,8 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
-
 	"github.com/ssddanbrown/haste/options"
+	"golang.org/x/net/html"
 )
 
 type templateTag struct {
@@ -21,8 +20,27 @@ type templateTag struct {
 	tagType         string
 	path            string
 	attrs           map[string][]byte
+	htmlAttrs       []html.Attribute
 	varContent      map[string][]byte
+	lists           map[string]bool
 	topLevel        bool
+	markdownContent bool
+
+	// Position of the tag or, for block tags, the start of its content
+	line   int
+	column int
+
+	// Positions of the variable tags within the injected content
+	varPositions variablePositions
+
+	// Block tag state, Used by tags that capture their content unparsed.
+	// Depths track nested block tags and other nested template tags.
+	elseContent   []byte
+	inElse        bool
+	elseLine      int
+	elseColumn    int
+	captureDepth  int
+	templateDepth int
 }
 
 func NewVariableTag(name []byte, opts *options.Options) *templateTag {
@@ -48,6 +66,22 @@ func NewTemplateTag(name []byte, attrs map[string][]byte, opts *options.Options,
 	return tag
 }
 
+// capturesContent indicates if the content of this tag should be captured
+// raw, to be built when the tag is closed, rather than parsed as it's read.
+func (t *templateTag) capturesContent() bool {
+	return t.tagType == "conditional" || t.tagType == "loop"
+}
+
+// appendContent adds content to the injectedContent of this tag or
+// the else content if an else tag has been found.
+func (t *templateTag) appendContent(content []byte) {
+	if t.inElse {
+		t.elseContent = append(t.elseContent, content...)
+	} else {
+		t.injectedContent = append(t.injectedContent, content...)
+	}
+}
+
 func (t *templateTag) nameToPath(ext string) string {
 	strName := string(t.name)
 	strName = strings.TrimSuffix(strName, ext)
@@ -60,7 +94,8 @@ func (t *templateTag) getReader() (io.Reader, error) {
 	strName := string(t.name)
 	var likelyLocations []string
 
-	extTypes := []string{"css", "js", "html"}
+	extTypes := append([]string{"css", "js", "md", "svg"}, imageExtensions...)
+	extTypes = append(extTypes, "html")
 	for _, baseExt := range extTypes {
 		ext := "." + baseExt
 		if baseExt == "html" || strings.HasSuffix(strName, ext) {
@@ -84,26 +119,56 @@ func (t *templateTag) Parse(parentBuilder *Builder) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if closer, ok := tagReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if isImageType(t.contentType) {
+		return t.imageTag(tagReader)
+	}
 
 	// Generate injectedContent
 	tagBuilder := NewBuilder(tagReader, parentBuilder.Options, parentBuilder)
+	tagBuilder.path = t.path
+	tagBuilder.tag = t
 
 	// Clean and parse inner injectedContent before merging tags
 	// Prevents attr vars leaking into scope of the injectedContent
 	injectedContent := bytes.Trim(t.injectedContent, "\n\r ")
-	injectedContentReader := parseVariableTags(bytes.NewReader(injectedContent), tagBuilder.Vars, parentBuilder.Options, false)
+	reportVariableError := parentBuilder.variableErrorReporter(&t.varPositions, t.line, t.column)
+	injectedContentReader := parseVariableTags(bytes.NewReader(injectedContent), tagBuilder.Vars, parentBuilder.Options, false, parentBuilder.outputContext(), parentBuilder.resolveAsset, reportVariableError)
+	if t.markdownContent {
+		injectedContentReader = renderMarkdown(injectedContentReader, parentBuilder.errorReporter(t.line, t.column))
+	}
 	injectedContent, err = ioutil.ReadAll(injectedContentReader)
 
+	tagBuilder.contentType = t.contentType
+
+	// Lists set via variable tags replace, rather than extend, lists of the same name
+	for name := range t.lists {
+		tagBuilder.removeVarsWithPrefix(name + ".")
+	}
 	tagBuilder.mergeVars(t.attrs)
 	tagBuilder.Vars["content"] = injectedContent
 
 	// Finished rendered result of this tag's contents
-	tagSourceContentReader := tagBuilder.Build()
+	tagSourceContentReader, err := tagBuilder.Build()
+	if err != nil {
+		return nil, err
+	}
 
 	// Read injectedContent and wrap if style or script
 	// TODO - Refactor to stream? If possible here
 	tagSourceContent, err := ioutil.ReadAll(tagSourceContentReader)
-	if t.contentType == "css" {
+	if t.contentType == "css" && t.options.MinifyCSS {
+		tagSourceContent = minifyCSS(tagSourceContent)
+	} else if t.contentType == "js" && t.options.MinifyJS {
+		tagSourceContent = minifyJS(tagSourceContent)
+	}
+
+	if t.contentType == "svg" {
+		tagSourceContent = trimXMLProlog(tagSourceContent)
+	} else if t.contentType == "css" {
 		tagSourceContent = append([]byte("<style>\n"), tagSourceContent...)
 		tagSourceContent = append(tagSourceContent, []byte("\n</style>")...)
 	} else if t.contentType == "js" {
@@ -114,14 +179,27 @@ func (t *templateTag) Parse(parentBuilder *Builder) ([]byte, error) {
 	return tagSourceContent, err
 }
 
-func parseVariableTags(r io.Reader, vars map[string][]byte, opts *options.Options, isTopLevel bool) io.Reader {
+// parseVariableTags replaces variable tags in the given content with their values.
+// If a HTML context is provided values will be escaped to suit where they're output.
+// Asset tags are resolved using the given resolveAsset function, if provided.
+// Errors found when resolving values are passed, along with the expression
+// of the variable tag, to the given report function.
+func parseVariableTags(r io.Reader, vars map[string][]byte, opts *options.Options, isTopLevel bool, context *htmlContext, resolveAsset func(string) ([]byte, error), report func(string, error)) io.Reader {
 
-	returnReader, w := io.Pipe()
+	returnReader, pw := io.Pipe()
 
-	scanner := bufio.NewScanner(r)
+	scanner := newLineScanner(r)
 	go func() {
 
-		defer w.Close()
+		defer func() {
+			pw.CloseWithError(scanner.Err())
+		}()
+
+		// Track the context of written content if escaping output
+		var w io.Writer = pw
+		if context != nil {
+			w = &contextWriter{pw, context}
+		}
 
 		escChar := byte('@')
 		startTag := opts.VarTagOpen
@@ -162,13 +240,24 @@ func parseVariableTags(r io.Reader, vars map[string][]byte, opts *options.Option
 					// End tag
 					inTag = false
 					tagKey := string(line[tagStart+startTagLen : i])
-					w.Write(vars[tagKey])
+					var val []byte
+					var raw bool
+					var err error
+					if assetPath, isAsset := assetExpression(tagKey); !isAsset {
+						val, raw, err = resolveVariable(tagKey, vars)
+					} else if resolveAsset != nil {
+						val, err = resolveAsset(assetPath)
+					} else {
+						err = fmt.Errorf("Asset tag \"%s\" cannot be used here", tagKey)
+					}
+					if err != nil {
+						report(tagKey, err)
+					}
+					if context != nil && !raw {
+						val = context.Escape(val)
+					}
+					pw.Write(val)
 					tagEnd = i + endTagLen - 1
-				} else if inTag && i-tagStart > 100 {
-					// Tag name tracking cutoff
-					inTag = false
-					tagEnd = -1
-					w.Write(line[tagStart:i])
 				} else if isTopLevel && contentLen >= i+escapedTagStartLen && bytes.Equal(line[i:i+escapedTagStartLen], escapedTagStart) {
 					// Start of escaped tag
 					// Simply does not write out the escape char if top level
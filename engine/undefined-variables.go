@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/ssddanbrown/haste/options"
+)
+
+// checkUndefinedVariables reports references to undefined variables within
+// the given raw token content, which starts at the current position.
+// References with a default value, or that are escaped, are not reported.
+// Each reference is reported once, even if its content is built many times.
+func (b *Builder) checkUndefinedVariables(raw []byte) {
+	mode := b.Options.UndefinedVariables
+	if mode != options.UndefinedVariablesWarn && mode != options.UndefinedVariablesStrict {
+		return
+	}
+
+	severity := SeverityWarning
+	if mode == options.UndefinedVariablesStrict {
+		severity = SeverityError
+	}
+
+	eachVariableTag(raw, b.Options, func(expression []byte, offset int) {
+		if _, isAsset := assetExpression(string(expression)); isAsset {
+			return
+		}
+
+		name, _, hasDefault := splitVariableDefault(splitOutsideQuotes(string(expression), '|')[0])
+		if _, defined := b.Vars[name]; defined || hasDefault {
+			return
+		}
+
+		line, column := advancePosition(b.line, b.column, raw[:offset])
+		message := fmt.Sprintf("Undefined variable \"%s\"", name)
+		b.Diagnostics.AddOnce(b.diagnostic(severity, line, column, message))
+	})
+}
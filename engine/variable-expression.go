@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// resolveVariable provides the output value for the contents of a variable tag.
+// A default value can be provided after a "??" separator which will be used
+// if the variable is not set or is empty. Filters can then be applied to the
+// value by following it with a pipe and the filter name.
+// Returns if the value has been marked as raw, to be output without escaping.
+func resolveVariable(expression string, vars map[string][]byte) (val []byte, raw bool, err error) {
+	parts := splitOutsideQuotes(expression, '|')
+	name, defaultVal, hasDefault := splitVariableDefault(parts[0])
+
+	val = vars[name]
+	if hasDefault && len(bytes.TrimSpace(val)) == 0 {
+		val = []byte(defaultVal)
+	}
+
+	for _, filterExpression := range parts[1:] {
+		filterParts := filterArgs(filterExpression)
+		if len(filterParts) == 0 {
+			continue
+		}
+
+		if filterParts[0] == rawFilterName {
+			raw = true
+		}
+
+		val, err = applyFilter(filterParts[0], val, filterParts[1:])
+		if err != nil {
+			return val, raw, fmt.Errorf("%s in variable tag \"%s\"", err, expression)
+		}
+	}
+
+	return val, raw, nil
+}
+
+func splitVariableDefault(expression string) (name string, defaultVal string, hasDefault bool) {
+	parts := strings.SplitN(expression, "??", 2)
+	name = strings.TrimSpace(parts[0])
+	if len(parts) == 2 {
+		defaultVal = strings.TrimSpace(parts[1])
+		hasDefault = true
+	}
+	return name, defaultVal, hasDefault
+}
+
+// splitOutsideQuotes splits the given string on the separator ignoring
+// any separators found within quotes that start a word.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+		} else if (c == '"' || c == '\'') && (i == 0 || s[i-1] == ' ') {
+			quote = c
+		} else if c == sep {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// filterArgs splits a filter expression into the filter name followed by its
+// arguments. Arguments can be wrapped in quotes to contain spaces.
+func filterArgs(expression string) []string {
+	var args []string
+	for _, arg := range splitOutsideQuotes(strings.TrimSpace(expression), ' ') {
+		if len(arg) == 0 {
+			continue
+		}
+		if len(arg) > 1 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+			arg = arg[1 : len(arg)-1]
+		}
+		args = append(args, arg)
+	}
+	return args
+}
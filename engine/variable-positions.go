@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ssddanbrown/haste/options"
+)
+
+// A variablePosition is the position of a variable tag within its source file.
+type variablePosition struct {
+	expression string
+	line       int
+	column     int
+}
+
+// variablePositions tracks the source positions of variable tags in the
+// order they're written as content, so that errors found when later
+// resolving those tags can be reported at their position.
+type variablePositions struct {
+	mutex sync.Mutex
+	items []variablePosition
+}
+
+// record adds the positions of the variable tags within the given raw
+// content, which starts at the given line and column.
+func (p *variablePositions) record(raw []byte, line int, column int, opts *options.Options) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	eachVariableTag(raw, opts, func(expression []byte, offset int) {
+		tagLine, tagColumn := advancePosition(line, column, raw[:offset])
+		p.items = append(p.items, variablePosition{string(expression), tagLine, tagColumn})
+	})
+}
+
+// find provides the position of the next recorded variable tag with the
+// given expression, dropping it and any tags before it from the list.
+func (p *variablePositions) find(expression string) (line int, column int, found bool) {
+	if p == nil {
+		return 0, 0, false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, position := range p.items {
+		if position.expression == expression {
+			p.items = p.items[i+1:]
+			return position.line, position.column, true
+		}
+	}
+	return 0, 0, false
+}
+
+// eachVariableTag calls the given function for each single-line, unescaped
+// variable tag within the given raw content, providing the expression of
+// the tag and the offset that the tag starts at.
+func eachVariableTag(raw []byte, opts *options.Options, fn func(expression []byte, offset int)) {
+	startTag := opts.VarTagOpen
+	endTag := opts.VarTagClose
+	offset := 0
+	for {
+		tagStart := bytes.Index(raw[offset:], startTag)
+		if tagStart < 0 {
+			return
+		}
+		tagStart += offset
+
+		tagEnd := bytes.Index(raw[tagStart+len(startTag):], endTag)
+		if tagEnd < 0 {
+			return
+		}
+		tagEnd += tagStart + len(startTag)
+		offset = tagEnd + len(endTag)
+
+		expression := raw[tagStart+len(startTag) : tagEnd]
+		isEscaped := tagStart > 0 && raw[tagStart-1] == '@'
+		if isEscaped || bytes.ContainsAny(expression, "\n") {
+			continue
+		}
+
+		fn(expression, tagStart)
+	}
+}
+
+// variableErrorReporter provides a function that adds errors found when resolving
+// variable tags, located at the position of the tag as found in the given
+// positions or, if not found, at the given line and column.
+func (b *Builder) variableErrorReporter(positions *variablePositions, line int, column int) func(string, error) {
+	return func(expression string, err error) {
+		tagLine, tagColumn, found := positions.find(expression)
+		if !found {
+			tagLine, tagColumn = line, column
+		}
+		b.Diagnostics.AddOnce(b.diagnostic(SeverityError, tagLine, tagColumn, err.Error()))
+	}
+}
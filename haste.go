@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 
@@ -16,20 +17,30 @@ func main() {
 	// Get options and parse command line options
 	opts := options.NewOptions()
 	err := opts.ParseCommandFlags()
+	if err != nil {
+		color.Red("%s", err)
+		os.Exit(1)
+	}
 	opts.LoadFileResolver()
-	check(err)
 
 	// Create a new manager
 	manager := engine.NewManager(opts)
 
 	// Build all found files
-	manager.BuildAll()
+	_, err = manager.BuildAll()
+	if err != nil {
+		color.Red("%s", err)
+	}
 
 	// Watch if specified
 	if opts.Watch {
 		startWatcher(manager, opts)
 	}
 
+	if err != nil {
+		os.Exit(1)
+	}
+
 }
 
 func startWatcher(m *engine.Manager, opts *options.Options) {
@@ -0,0 +1,179 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Names of the project config files searched for in the root path, in order of preference
+var ConfigFileNames = []string{"haste.json", "haste.toml"}
+
+// Config holds the options that can be set via a project config file.
+// Unset values leave the existing option unchanged.
+type Config struct {
+	OutPath                    string                 `json:"outPath" toml:"outPath"`
+	BuildFileExtension         string                 `json:"buildFileExtension" toml:"buildFileExtension"`
+	MarkdownBuildFileExtension string                 `json:"markdownBuildFileExtension" toml:"markdownBuildFileExtension"`
+	Include                    []string               `json:"include" toml:"include"`
+	Exclude                    []string               `json:"exclude" toml:"exclude"`
+	Passthrough                []string               `json:"passthrough" toml:"passthrough"`
+	Vars                       map[string]interface{} `json:"vars" toml:"vars"`
+
+	TagPrefix          string `json:"tagPrefix" toml:"tagPrefix"`
+	VarTagPrefix       string `json:"varTagPrefix" toml:"varTagPrefix"`
+	VarTagOpen         string `json:"varTagOpen" toml:"varTagOpen"`
+	VarTagClose        string `json:"varTagClose" toml:"varTagClose"`
+	AutoEscape         *bool  `json:"autoEscape" toml:"autoEscape"`
+	MaxRecursionDepth  *int   `json:"maxRecursionDepth" toml:"maxRecursionDepth"`
+	WarningsAsErrors   *bool  `json:"warningsAsErrors" toml:"warningsAsErrors"`
+	UndefinedVariables string `json:"undefinedVariables" toml:"undefinedVariables"`
+	AttributeCase      string `json:"attributeCase" toml:"attributeCase"`
+	Verbose            *bool  `json:"verbose" toml:"verbose"`
+	BuildCache         *bool  `json:"buildCache" toml:"buildCache"`
+	Workers            *int   `json:"workers" toml:"workers"`
+
+	Minify struct {
+		HTML *bool `json:"html" toml:"html"`
+		CSS  *bool `json:"css" toml:"css"`
+		JS   *bool `json:"js" toml:"js"`
+	} `json:"minify" toml:"minify"`
+
+	Server struct {
+		Watch      *bool `json:"watch" toml:"watch"`
+		Port       *int  `json:"port" toml:"port"`
+		LiveReload *bool `json:"liveReload" toml:"liveReload"`
+	} `json:"server" toml:"server"`
+
+	// Named sets of config, applied on top of the base config when selected
+	Profiles map[string]*Config `json:"profiles" toml:"profiles"`
+}
+
+// LoadConfigFile finds a project config file in the given root path and applies
+// it to the options, along with the config of the selected profile if set.
+// Returns the path of the file loaded, or an empty string if no config file was found.
+func (o *Options) LoadConfigFile(rootPath string) (string, error) {
+	for _, name := range ConfigFileNames {
+		configPath := filepath.Join(rootPath, name)
+		content, err := ioutil.ReadFile(configPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return configPath, err
+		}
+
+		config := &Config{}
+		if filepath.Ext(name) == ".toml" {
+			err = toml.Unmarshal(content, config)
+		} else {
+			err = json.Unmarshal(content, config)
+		}
+		if err != nil {
+			return configPath, fmt.Errorf("Could not parse config file \"%s\": %s", configPath, err)
+		}
+
+		o.ApplyConfig(config, rootPath)
+		if o.Profile != "" {
+			profile, ok := config.Profiles[o.Profile]
+			if !ok {
+				return configPath, fmt.Errorf("Could not find profile \"%s\" in config file \"%s\"", o.Profile, configPath)
+			}
+			o.ApplyConfig(profile, rootPath)
+		}
+		return configPath, o.Validate()
+	}
+
+	if o.Profile != "" {
+		return "", fmt.Errorf("Could not find a config file for profile \"%s\"", o.Profile)
+	}
+	return "", nil
+}
+
+// ApplyConfig sets the options provided by the given config.
+// Paths within the config are relative to the given root path.
+func (o *Options) ApplyConfig(c *Config, rootPath string) {
+	if c.OutPath != "" {
+		o.OutPath = filepath.Join(rootPath, c.OutPath)
+	}
+	setString(&o.BuildFileExtension, c.BuildFileExtension)
+	setString(&o.MarkdownBuildFileExtension, c.MarkdownBuildFileExtension)
+	if c.Include != nil {
+		o.InputGlobs = c.Include
+	}
+	if c.Exclude != nil {
+		o.ExcludeGlobs = c.Exclude
+	}
+	if c.Passthrough != nil {
+		o.PassthroughGlobs = c.Passthrough
+	}
+	if c.Vars != nil {
+		o.Vars = mergeVars(o.Vars, c.Vars)
+	}
+
+	setBytes(&o.TagPrefix, c.TagPrefix)
+	setBytes(&o.VarTagPrefix, c.VarTagPrefix)
+	setBytes(&o.VarTagOpen, c.VarTagOpen)
+	setBytes(&o.VarTagClose, c.VarTagClose)
+	setBool(&o.AutoEscape, c.AutoEscape)
+	setInt(&o.MaxRecursionDepth, c.MaxRecursionDepth)
+	setBool(&o.WarningsAsErrors, c.WarningsAsErrors)
+	setString(&o.UndefinedVariables, c.UndefinedVariables)
+	setString(&o.AttributeCase, c.AttributeCase)
+	setBool(&o.Verbose, c.Verbose)
+	setBool(&o.BuildCache, c.BuildCache)
+	setInt(&o.Workers, c.Workers)
+	setBool(&o.MinifyHTML, c.Minify.HTML)
+	setBool(&o.MinifyCSS, c.Minify.CSS)
+	setBool(&o.MinifyJS, c.Minify.JS)
+
+	setBool(&o.Watch, c.Server.Watch)
+	setInt(&o.ServerPort, c.Server.Port)
+	setBool(&o.LiveReload, c.Server.LiveReload)
+}
+
+func setString(option *string, val string) {
+	if val != "" {
+		*option = val
+	}
+}
+
+// mergeVars provides the given base vars with the given vars merged in,
+// key by key, with nested values being merged in the same way.
+func mergeVars(base map[string]interface{}, vars map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for key, val := range base {
+		merged[key] = val
+	}
+	for key, val := range vars {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		valMap, valIsMap := val.(map[string]interface{})
+		if baseIsMap && valIsMap {
+			val = mergeVars(baseMap, valMap)
+		}
+		merged[key] = val
+	}
+	return merged
+}
+
+func setBytes(option *[]byte, val string) {
+	if val != "" {
+		*option = []byte(val)
+	}
+}
+
+func setBool(option *bool, val *bool) {
+	if val != nil {
+		*option = *val
+	}
+}
+
+func setInt(option *int, val *int) {
+	if val != nil {
+		*option = *val
+	}
+}
@@ -5,10 +5,25 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 
 	"github.com/ssddanbrown/haste/loading"
 )
 
+// Modes for the reporting of undefined variables
+const (
+	UndefinedVariablesIgnore = "ignore"
+	UndefinedVariablesWarn   = "warn"
+	UndefinedVariablesStrict = "strict"
+)
+
+// Modes for the naming of variables provided via tag attributes
+const (
+	AttributeCaseLower    = "lower"
+	AttributeCasePreserve = "preserve"
+	AttributeCaseCamel    = "camel"
+)
+
 // Options hold all the haste specific options available
 type Options struct {
 	Verbose bool
@@ -17,16 +32,57 @@ type Options struct {
 	TemplateResolver loading.TemplateResolver
 
 	// Manager Options
-	OutPath            string
-	RootPath           string
-	InputPaths         []string
-	BuildFileExtension string
+	OutPath                    string
+	RootPath                   string
+	InputPaths                 []string
+	BuildFileExtension         string
+	MarkdownBuildFileExtension string
+
+	// File name globs used to find build files, Defaults to the build file extensions
+	InputGlobs []string
+
+	// Root relative path globs of files and folders to ignore when finding build files
+	ExcludeGlobs []string
+
+	// Root relative path globs of files and folders to copy, as they are, to the output folder
+	PassthroughGlobs []string
 
 	// Build Options
 	TagPrefix    []byte
 	VarTagPrefix []byte
 	VarTagOpen   []byte
 	VarTagClose  []byte
+	AutoEscape   bool
+
+	// Maximum times a recursive template can be included within itself
+	MaxRecursionDepth int
+
+	// Fail builds that have warnings in addition to errors
+	WarningsAsErrors bool
+
+	// How references to undefined variables are reported: ignore, warn or strict
+	UndefinedVariables string
+
+	// How tag attribute names map to variable names: lower, preserve or camel
+	AttributeCase string
+
+	// Global variables available to all build files
+	Vars map[string]interface{}
+
+	// Minification of output HTML and of inlined CSS and JavaScript
+	MinifyHTML bool
+	MinifyCSS  bool
+	MinifyJS   bool
+
+	// Name of the config file profile to apply on top of the base config
+	Profile string
+
+	// Skip building files that are unchanged since the last build, using
+	// a cache stored in the root folder
+	BuildCache bool
+
+	// Number of files to build at once
+	Workers int
 
 	// Server options
 	Watch      bool
@@ -37,13 +93,20 @@ type Options struct {
 // NewOptions provides a new set of options with defaults set
 func NewOptions() *Options {
 	o := &Options{
-		BuildFileExtension: ".haste.html",
+		BuildFileExtension:         ".haste.html",
+		MarkdownBuildFileExtension: ".haste.md",
 
 		TagPrefix:    []byte("t:"),
 		VarTagPrefix: []byte("v:"),
 		VarTagOpen:   []byte("{{"),
 		VarTagClose:  []byte("}}"),
 
+		MaxRecursionDepth:  10,
+		UndefinedVariables: UndefinedVariablesIgnore,
+		AttributeCase:      AttributeCaseLower,
+		BuildCache:         true,
+		Workers:            runtime.NumCPU(),
+
 		Watch:      false,
 		ServerPort: 8081,
 		LiveReload: true,
@@ -57,22 +120,27 @@ func (o *Options) LoadFileResolver() {
 }
 
 // ParseCommandFlags to read user-provided input from the command-line
-// and update the options with what's provided.
+// and update the options with what's provided. Options are first loaded
+// from any project config file in the root path, which flags then override.
 func (o *Options) ParseCommandFlags() error {
 	watch := flag.Bool("w", false, "Watch HTML file and auto-compile")
 	port := flag.Int("p", 8081, "Provide a port to listen on")
 	disableLiveReload := flag.Bool("l", false, "Disable livereload (When watching only)")
 	verbose := flag.Bool("v", false, "Enable verbose output")
+	autoEscape := flag.Bool("e", false, "Auto-escape variable output based on where it's used")
+	maxRecursionDepth := flag.Int("m", 10, "Maximum depth that recursive templates can be included")
+	warningsAsErrors := flag.Bool("W", false, "Treat build warnings as errors")
+	undefinedVariables := flag.String("u", UndefinedVariablesIgnore, "Report undefined variables: ignore, warn or strict")
+	attributeCase := flag.String("a", AttributeCaseLower, "Case of variables provided via tag attributes: lower, preserve or camel")
+	minify := flag.Bool("M", false, "Minify output HTML and inlined CSS and JavaScript")
+	profile := flag.String("P", "", "Name of the config file profile to use")
+	workers := flag.Int("j", runtime.NumCPU(), "Number of files to build at once")
+	forceRebuild := flag.Bool("f", false, "Rebuild all files, ignoring the build cache")
 	distPtr := flag.String("d", "./dist/", "Output folder for generated content")
 	rootPathPtr := flag.String("r", "./", "The root relative directory build path for template location")
 
 	flag.Parse()
 
-	o.Verbose = *verbose
-	o.Watch = *watch
-	o.ServerPort = *port
-	o.LiveReload = !*disableLiveReload
-
 	args := flag.Args()
 
 	wd, err := os.Getwd()
@@ -85,20 +153,76 @@ func (o *Options) ParseCommandFlags() error {
 			rootPath, err = filepath.Abs(filepath.Join(wd, args[0]))
 		}
 	}
+	o.RootPath = rootPath
+	o.Profile = *profile
 
-	// Set output path
-	outPath, err := filepath.Abs(filepath.Join(wd, *distPtr))
+	_, err = o.LoadConfigFile(rootPath)
 	if err != nil {
 		return err
 	}
 
-	err = createFolderIfNotExisting(outPath)
+	// Apply flags that have been set, overriding the config file
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	if setFlags["v"] {
+		o.Verbose = *verbose
+	}
+	if setFlags["e"] {
+		o.AutoEscape = *autoEscape
+	}
+	if setFlags["m"] {
+		o.MaxRecursionDepth = *maxRecursionDepth
+	}
+	if setFlags["W"] {
+		o.WarningsAsErrors = *warningsAsErrors
+	}
+	if setFlags["u"] {
+		o.UndefinedVariables = *undefinedVariables
+	}
+	if setFlags["a"] {
+		o.AttributeCase = *attributeCase
+	}
+	if setFlags["M"] {
+		o.MinifyHTML = *minify
+		o.MinifyCSS = *minify
+		o.MinifyJS = *minify
+	}
+	if setFlags["j"] {
+		o.Workers = *workers
+	}
+	if setFlags["f"] {
+		o.BuildCache = !*forceRebuild
+	}
+	if setFlags["w"] {
+		o.Watch = *watch
+	}
+	if setFlags["p"] {
+		o.ServerPort = *port
+	}
+	if setFlags["l"] {
+		o.LiveReload = !*disableLiveReload
+	}
+
+	err = o.Validate()
 	if err != nil {
 		return err
 	}
 
-	o.RootPath = rootPath
-	o.OutPath = outPath
+	// Set output path
+	if setFlags["d"] || o.OutPath == "" {
+		o.OutPath, err = filepath.Abs(filepath.Join(wd, *distPtr))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = createFolderIfNotExisting(o.OutPath)
+	if err != nil {
+		return err
+	}
 
 	// Find files to load from args or use working directory
 	var inputPaths []string
@@ -115,6 +239,20 @@ func (o *Options) ParseCommandFlags() error {
 	return err
 }
 
+// Validate checks that options with a set of allowed values are valid.
+func (o *Options) Validate() error {
+	if o.UndefinedVariables != UndefinedVariablesIgnore && o.UndefinedVariables != UndefinedVariablesWarn && o.UndefinedVariables != UndefinedVariablesStrict {
+		return fmt.Errorf("Invalid undefined variables mode \"%s\", Expected ignore, warn or strict", o.UndefinedVariables)
+	}
+	if o.AttributeCase != AttributeCaseLower && o.AttributeCase != AttributeCasePreserve && o.AttributeCase != AttributeCaseCamel {
+		return fmt.Errorf("Invalid attribute case \"%s\", Expected lower, preserve or camel", o.AttributeCase)
+	}
+	if o.Workers < 1 {
+		return fmt.Errorf("Invalid number of workers %d, Expected at least 1", o.Workers)
+	}
+	return nil
+}
+
 func createFolderIfNotExisting(folderPath string) error {
 	_, err := os.Stat(folderPath)
 	if !os.IsNotExist(err) {
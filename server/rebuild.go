@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// A fileChange is a change to a file, or folder, that requires a rebuild
+type fileChange struct {
+	path    string
+	removed bool
+}
+
+// queueRebuild cancels any in-progress rebuild and starts a new rebuild that
+// handles the given change along with any left unhandled by cancelled rebuilds.
+func (s *Server) queueRebuild(change fileChange) {
+	s.pendingLock.Lock()
+	if s.cancelRebuild != nil {
+		s.cancelRebuild()
+	}
+	s.pendingChanges = append(s.pendingChanges, change)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelRebuild = cancel
+	s.pendingLock.Unlock()
+
+	go s.rebuild(ctx)
+}
+
+// rebuild handles all pending changes then alerts livereload of the
+// files changed. Changes are left pending if the rebuild is cancelled.
+func (s *Server) rebuild(ctx context.Context) {
+	s.rebuildLock.Lock()
+	defer s.rebuildLock.Unlock()
+
+	s.pendingLock.Lock()
+	changes := append([]fileChange(nil), s.pendingChanges...)
+	s.pendingLock.Unlock()
+
+	var changedFiles []string
+	for _, change := range changes {
+		var outFiles []string
+		var err error
+		if change.removed {
+			outFiles, err = s.Manager.NotifyRemoveContext(ctx, change.path)
+			changedFiles = append(changedFiles, change.path)
+		} else {
+			outFiles, err = s.Manager.NotifyChangeContext(ctx, change.path)
+		}
+
+		// Changes will be handled by the newer rebuild
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			color.Red("%s", err)
+		}
+		changedFiles = append(changedFiles, outFiles...)
+	}
+
+	s.pendingLock.Lock()
+	s.pendingChanges = s.pendingChanges[len(changes):]
+	s.pendingLock.Unlock()
+
+	time.AfterFunc(50*time.Millisecond, func() {
+		for _, file := range changedFiles {
+			s.changedFiles <- file
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
@@ -33,6 +35,12 @@ type Server struct {
 	WatchedRootFiles []string
 	WatchDepth       int
 	Options          *options.Options
+
+	// Rebuild state, allowing in-progress rebuilds to be cancelled by newer changes
+	pendingChanges []fileChange
+	pendingLock    sync.Mutex
+	cancelRebuild  context.CancelFunc
+	rebuildLock    sync.Mutex
 }
 
 func NewServer(manager *engine.Manager, opts *options.Options) *Server {
@@ -125,9 +133,10 @@ func (s *Server) handleFileChange(changedFile string) {
 		return
 	}
 
-	// Check if a relevant extension
-	watchedExtensions := []string{".html", ".css", ".js"}
-	reload := false
+	// Check if a relevant extension, a file used by a build file
+	// or a file to be copied to the output
+	watchedExtensions := []string{".html", ".md", ".css", ".js", ".json", ".yaml", ".yml", ".toml"}
+	reload := s.Manager.IsPassthroughFile(changedFile) || s.Manager.HasDependents(changedFile)
 	for _, ext := range watchedExtensions {
 		if filepath.Ext(changedFile) == ext {
 			reload = true
@@ -145,16 +154,30 @@ func (s *Server) handleFileChange(changedFile string) {
 
 	// Build and reload files
 	time.AfterFunc(50*time.Millisecond, func() {
+		s.queueRebuild(fileChange{path: changedFile})
+	})
 
-		outFiles := s.Manager.NotifyChange(changedFile)
+}
 
-		time.AfterFunc(50*time.Millisecond, func() {
-			for _, file := range outFiles {
-				s.changedFiles <- file
-			}
-		})
-	})
+// handleFileRemove handles a removed, or renamed, file or folder by removing
+// its outputs and rebuilding any files that depended on it. Renamed files
+// are built at their new location via a separate create event.
+func (s *Server) handleFileRemove(removedFile string) {
+	s.unwatchFolder(removedFile)
 
+	removedFile, err := filepath.Rel(s.Options.RootPath, removedFile)
+	check(err)
+
+	// Ignore git directories
+	if strings.Contains(removedFile, ".git/") {
+		return
+	}
+
+	s.verboseLog(fmt.Sprintf("Removal occurred of %s", removedFile))
+
+	time.AfterFunc(50*time.Millisecond, func() {
+		s.queueRebuild(fileChange{path: removedFile, removed: true})
+	})
 }
 
 func (s *Server) startFileWatcher() error {
@@ -182,6 +205,9 @@ func (s *Server) startFileWatcher() error {
 					s.handleFileCreate(ev.Name)
 					s.handleFileChange(ev.Name)
 				}
+				if ev.Op&fsnotify.Remove == fsnotify.Remove || ev.Op&fsnotify.Rename == fsnotify.Rename {
+					s.handleFileRemove(ev.Name)
+				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
@@ -246,6 +272,18 @@ func (s *Server) watchFolder(folderPath string) error {
 	return nil
 }
 
+// unwatchFolder stops tracking the given folder, and those within it,
+// so they can be watched again if re-created.
+func (s *Server) unwatchFolder(folderPath string) {
+	var watchedFolders []string
+	for _, folder := range s.WatchedFolders {
+		if folder != folderPath && !strings.HasPrefix(folder, folderPath+string(filepath.Separator)) {
+			watchedFolders = append(watchedFolders, folder)
+		}
+	}
+	s.WatchedFolders = watchedFolders
+}
+
 func (s *Server) getManagerRouting() *http.ServeMux {
 
 	handler := http.NewServeMux()